@@ -0,0 +1,235 @@
+// Package aria2 is a client for the aria2 JSON-RPC interface.
+package aria2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Client struct {
+	URL    string
+	client *http.Client
+	secret string
+	mu     sync.Mutex
+	id     int
+}
+
+// Status is the status of a download as returned by aria2.tellStatus.
+// aria2 encodes numbers as strings.
+type Status struct {
+	Gid             string     `json:"gid"`
+	Status          string     `json:"status"`
+	TotalLength     Int        `json:"totalLength"`
+	CompletedLength Int        `json:"completedLength"`
+	DownloadSpeed   Int        `json:"downloadSpeed"`
+	UploadSpeed     Int        `json:"uploadSpeed"`
+	Connections     Int        `json:"connections"`
+	Dir             string     `json:"dir"`
+	ErrorCode       string     `json:"errorCode"`
+	ErrorMessage    string     `json:"errorMessage"`
+	InfoHash        string     `json:"infoHash"`
+	FollowedBy      []string   `json:"followedBy"`
+	Bittorrent      Bittorrent `json:"bittorrent"`
+}
+
+type Bittorrent struct {
+	Info struct {
+		Name string `json:"name"`
+	} `json:"info"`
+}
+
+// Name returns the name of the torrent, if known.
+func (s Status) Name() string {
+	return s.Bittorrent.Info.Name
+}
+
+// Progress returns the downloaded fraction, between 0 and 1.
+func (s Status) Progress() float64 {
+	if s.TotalLength == 0 {
+		return 0
+	}
+	return float64(s.CompletedLength) / float64(s.TotalLength)
+}
+
+// Int is an integer encoded as a JSON string.
+type Int int64
+
+func (i *Int) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	*i = Int(n)
+	return err
+}
+
+// StatusKeys are the keys requested by TellStatus and Downloads.
+var StatusKeys = []string{
+	"gid", "status", "totalLength", "completedLength", "downloadSpeed",
+	"uploadSpeed", "connections", "dir", "errorCode", "errorMessage",
+	"infoHash", "followedBy", "bittorrent",
+}
+
+// Error is an error returned by aria2.
+type Error struct {
+	Method  string
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (code %d)", e.Method, e.Message, e.Code)
+}
+
+// DefaultHTTPClient is used when NewClient is given a nil *http.Client.
+var DefaultHTTPClient = &http.Client{Timeout: time.Minute}
+
+// NewClient returns a client for the aria2 JSON-RPC endpoint at URL
+// (e.g. http://localhost:6800/jsonrpc), authenticating with the
+// --rpc-secret token if not empty. Requests are sent with hc, or
+// DefaultHTTPClient if hc is nil.
+func NewClient(ctx context.Context, hc *http.Client, URL, secret string) (*Client, error) {
+	if hc == nil {
+		hc = DefaultHTTPClient
+	}
+	u, err := url.Parse(URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/jsonrpc"
+	}
+	c := &Client{URL: u.String(), client: hc, secret: secret}
+	var version struct {
+		Version string `json:"version"`
+	}
+	return c, c.Call(ctx, "aria2.getVersion", nil, &version)
+}
+
+// Call runs the JSON-RPC method and decodes its result into result,
+// unless result is nil. The secret token is prepended to params.
+func (c *Client) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if c.secret != "" {
+		params = append([]interface{}{"token:" + c.secret}, params...)
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+	c.mu.Lock()
+	c.id++
+	id := c.id
+	c.mu.Unlock()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      strconv.Itoa(id),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// aria2 replies with an HTTP error status together with a JSON-RPC
+	// error, so the body is decoded first
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("got error %d (%s) while calling %s", resp.StatusCode, resp.Status, method)
+		}
+		return fmt.Errorf("invalid reply to %s: %v", method, err)
+	}
+	if reply.Error != nil {
+		reply.Error.Method = method
+		return reply.Error
+	}
+	if result == nil || len(reply.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// AddURI adds a download of uri (e.g. a magnet link) in dir and returns
+// its gid. If paused is true the download is added paused.
+func (c *Client) AddURI(ctx context.Context, uri, dir string, paused bool) (string, error) {
+	opts := map[string]string{}
+	if dir != "" {
+		opts["dir"] = dir
+	}
+	if paused {
+		opts["pause"] = "true"
+	}
+	var gid string
+	err := c.Call(ctx, "aria2.addUri", []interface{}{[]string{uri}, opts}, &gid)
+	return gid, err
+}
+
+// TellStatus returns the status of a download.
+func (c *Client) TellStatus(ctx context.Context, gid string) (Status, error) {
+	var s Status
+	err := c.Call(ctx, "aria2.tellStatus", []interface{}{gid, StatusKeys}, &s)
+	return s, err
+}
+
+// maxStopped is the maximum number of waiting and stopped downloads
+// returned by Downloads.
+const maxStopped = 1000
+
+// Downloads returns the active, waiting and stopped downloads.
+func (c *Client) Downloads(ctx context.Context) ([]Status, error) {
+	var all []Status
+	var active, waiting, stopped []Status
+	if err := c.Call(ctx, "aria2.tellActive", []interface{}{StatusKeys}, &active); err != nil {
+		return nil, err
+	}
+	if err := c.Call(ctx, "aria2.tellWaiting", []interface{}{0, maxStopped, StatusKeys}, &waiting); err != nil {
+		return nil, err
+	}
+	if err := c.Call(ctx, "aria2.tellStopped", []interface{}{0, maxStopped, StatusKeys}, &stopped); err != nil {
+		return nil, err
+	}
+	all = append(all, active...)
+	all = append(all, waiting...)
+	return append(all, stopped...), nil
+}
+
+// Remove removes a download. aria2 does not delete downloaded files.
+func (c *Client) Remove(ctx context.Context, gid string) error {
+	return c.Call(ctx, "aria2.remove", []interface{}{gid}, nil)
+}
+
+// RemoveResult forgets a completed, failed or removed download.
+func (c *Client) RemoveResult(ctx context.Context, gid string) error {
+	return c.Call(ctx, "aria2.removeDownloadResult", []interface{}{gid}, nil)
+}
+
+// Pause pauses a download.
+func (c *Client) Pause(ctx context.Context, gid string) error {
+	return c.Call(ctx, "aria2.pause", []interface{}{gid}, nil)
+}
+
+// Unpause resumes a paused download.
+func (c *Client) Unpause(ctx context.Context, gid string) error {
+	return c.Call(ctx, "aria2.unpause", []interface{}{gid}, nil)
+}
@@ -0,0 +1,129 @@
+package aria2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type rpcRequest struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     string            `json:"id"`
+}
+
+// fakeServer is an aria2 stand-in requiring the secret token "s3cret".
+func fakeServer(t *testing.T, calls map[string][]json.RawMessage) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/jsonrpc" {
+			http.NotFound(w, r)
+			return
+		}
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			return
+		}
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		var token string
+		if len(req.Params) > 0 {
+			json.Unmarshal(req.Params[0], &token)
+		}
+		if token != "token:s3cret" {
+			w.WriteHeader(http.StatusBadRequest)
+			reply["error"] = map[string]interface{}{"code": 1, "message": "Unauthorized"}
+			json.NewEncoder(w).Encode(reply)
+			return
+		}
+		calls[req.Method] = req.Params[1:]
+		switch req.Method {
+		case "aria2.getVersion":
+			reply["result"] = map[string]interface{}{"version": "1.37.0"}
+		case "aria2.addUri":
+			reply["result"] = "2089b05ecca3d829"
+		case "aria2.tellStatus":
+			reply["result"] = map[string]interface{}{
+				"gid":             "2089b05ecca3d829",
+				"status":          "active",
+				"totalLength":     "1000",
+				"completedLength": "250",
+				"downloadSpeed":   "100",
+				"dir":             "/downloads",
+				"bittorrent":      map[string]interface{}{"info": map[string]interface{}{"name": "Show.S01E01"}},
+			}
+		case "aria2.remove", "aria2.pause", "aria2.unpause":
+			reply["result"] = "2089b05ecca3d829"
+		default:
+			reply["error"] = map[string]interface{}{"code": 1, "message": "Method not found"}
+		}
+		json.NewEncoder(w).Encode(reply)
+	}))
+}
+
+func TestSecret(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t, map[string][]json.RawMessage{})
+	defer srv.Close()
+
+	_, err := NewClient(ctx, nil, srv.URL, "wrong")
+	if e, ok := err.(*Error); !ok || e.Message != "Unauthorized" {
+		t.Errorf("expected Unauthorized error, got %v", err)
+	}
+	if _, err := NewClient(ctx, nil, srv.URL, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddURI(t *testing.T) {
+	ctx := context.Background()
+	calls := map[string][]json.RawMessage{}
+	srv := fakeServer(t, calls)
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL+"/jsonrpc", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gid, err := c.AddURI(ctx, "magnet:?xt=urn:btih:abcd", "/downloads/Show", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gid != "2089b05ecca3d829" {
+		t.Errorf("unexpected gid %q", gid)
+	}
+	var uris []string
+	var opts map[string]string
+	params := calls["aria2.addUri"]
+	if len(params) != 2 || json.Unmarshal(params[0], &uris) != nil || json.Unmarshal(params[1], &opts) != nil {
+		t.Fatalf("unexpected params %s", params)
+	}
+	if len(uris) != 1 || uris[0] != "magnet:?xt=urn:btih:abcd" {
+		t.Errorf("unexpected uris %v", uris)
+	}
+	if opts["dir"] != "/downloads/Show" || opts["pause"] != "true" {
+		t.Errorf("unexpected options %v", opts)
+	}
+}
+
+func TestTellStatus(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t, map[string][]json.RawMessage{})
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.TellStatus(ctx, "2089b05ecca3d829")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != "active" || s.TotalLength != 1000 || s.Progress() != 0.25 || s.Name() != "Show.S01E01" {
+		t.Errorf("unexpected status %+v", s)
+	}
+
+	if err := c.Call(ctx, "aria2.nosuchmethod", nil, nil); err == nil {
+		t.Errorf("expected error for unknown method")
+	}
+}
@@ -0,0 +1,156 @@
+// Package blackhole hands torrents to a client watching a directory,
+// by writing .magnet files or .torrent files into it.
+package blackhole
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Extensions appended by some clients to the files they loaded.
+var loadedSuffixes = []string{".added", ".loaded"}
+
+// State of a file written to the watch directory.
+type State int
+
+const (
+	// Missing: the file is gone, usually because the client loaded it
+	// and deleted it.
+	Missing State = iota
+	// Pending: the file is still waiting for the client.
+	Pending
+	// Loaded: the client renamed the file after loading it.
+	Loaded
+)
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Loaded:
+		return "loaded"
+	}
+	return "missing"
+}
+
+// DefaultHTTPClient is used when Add is given a nil *http.Client.
+var DefaultHTTPClient = &http.Client{Timeout: time.Minute}
+
+// Add writes uri into dir and returns the path of the new file. Magnet
+// links are written as <name>.magnet, other URLs are downloaded with hc,
+// or DefaultHTTPClient if nil, and saved as <name>.torrent. Files are
+// written under a temporary name and then renamed, so the client never
+// sees a partial file.
+func Add(ctx context.Context, hc *http.Client, dir, name, uri string) (string, error) {
+	if hc == nil {
+		hc = DefaultHTTPClient
+	}
+	name = fileName(name)
+	if name == "" {
+		return "", fmt.Errorf("invalid file name for %s", uri)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	var data io.Reader
+	ext := ".magnet"
+	if strings.HasPrefix(uri, "magnet:") {
+		data = strings.NewReader(uri + "\n")
+	} else {
+		req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := hc.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return "", fmt.Errorf("got error %d (%s) while fetching %s", resp.StatusCode, resp.Status, uri)
+		}
+		data = resp.Body
+		ext = ".torrent"
+	}
+
+	path := filepath.Join(dir, name+ext)
+	if _, err := os.Stat(path); err == nil {
+		return path, fmt.Errorf("file %s already exists", path)
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+"*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return path, nil
+}
+
+// fileName makes name safe to be used as a file name.
+func fileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.Trim(name, ". ")
+}
+
+// Stat returns the state of a file written by Add.
+func Stat(path string) State {
+	if _, err := os.Stat(path); err == nil {
+		return Pending
+	}
+	for _, suffix := range loadedSuffixes {
+		if _, err := os.Stat(path + suffix); err == nil {
+			return Loaded
+		}
+	}
+	return Missing
+}
+
+// Remove deletes a file written by Add, if the client has not loaded it
+// yet.
+func Remove(path string) error {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns the .magnet and .torrent files waiting in dir.
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if !e.IsDir() && (ext == ".magnet" || ext == ".torrent") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return files, nil
+}
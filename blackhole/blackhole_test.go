@@ -0,0 +1,98 @@
+package blackhole
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddMagnet(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	magnet := "magnet:?xt=urn:btih:abcd&dn=Show"
+	path, err := Add(ctx, nil, filepath.Join(dir, "watch"), "Show.S01E01.720p", magnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "watch", "Show.S01E01.720p.magnet") {
+		t.Errorf("unexpected path %q", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != magnet+"\n" {
+		t.Errorf("unexpected content %q", data)
+	}
+	if Stat(path) != Pending {
+		t.Errorf("expected pending, got %v", Stat(path))
+	}
+
+	if _, err := Add(ctx, nil, filepath.Join(dir, "watch"), "Show.S01E01.720p", magnet); err == nil {
+		t.Errorf("expected error when the file already exists")
+	}
+
+	// no temporary file is left behind
+	files, _ := List(filepath.Join(dir, "watch"))
+	if len(files) != 1 {
+		t.Errorf("expected 1 file, got %v", files)
+	}
+}
+
+func TestAddTorrent(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/show.torrent" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("d8:announce0:e"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	path, err := Add(ctx, nil, dir, "../Show/S01E02", srv.URL+"/show.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "_Show_S01E02.torrent") {
+		t.Errorf("unexpected path %q", path)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != "d8:announce0:e" {
+		t.Errorf("unexpected content %q", data)
+	}
+
+	if _, err := Add(ctx, nil, dir, "missing", srv.URL+"/missing.torrent"); err == nil {
+		t.Errorf("expected error for a missing torrent")
+	}
+	if files, _ := List(dir); len(files) != 1 {
+		t.Errorf("expected 1 file, got %v", files)
+	}
+}
+
+func TestStat(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path, err := Add(ctx, nil, dir, "Show", "magnet:?xt=urn:btih:abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path, path+".added"); err != nil {
+		t.Fatal(err)
+	}
+	if Stat(path) != Loaded {
+		t.Errorf("expected loaded, got %v", Stat(path))
+	}
+	os.Remove(path + ".added")
+	if Stat(path) != Missing {
+		t.Errorf("expected missing, got %v", Stat(path))
+	}
+	if err := Remove(path); err != nil {
+		t.Errorf("removing a missing file must not fail: %v", err)
+	}
+}
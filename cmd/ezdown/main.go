@@ -1,17 +1,20 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/arcimboldo/tv/downloader"
 	"github.com/arcimboldo/tv/eztv"
-	tms "github.com/arcimboldo/tv/transmission"
 )
 
 var (
@@ -20,13 +23,19 @@ var (
 	flagS       = flag.String("s", "any", "Matching season")
 	flagE       = flag.String("e", "any", "Matching episode")
 	flagMNum    = flag.Int("m", 1, "How many matches.")
+	flagSince   = flag.Duration("since", 0, "Only look at releases newer than this, e.g. 24h")
+	flagPages   = flag.Int("pages", 50, "Maximum number of pages of releases to look at, 0 for no limit")
 	flagList    = flag.Bool("list", false, "List last N shows")
 	flagSearch  = flag.Bool("search", false, "Search for shows")
 	flagAdd     = flag.Int("add", -1, "Add to torrent")
 	flagShow    = flag.String("show", "", "show")
 	flagGetShow = flag.String("get", "", "show")
 	flagLong    = flag.Bool("l", false, "Long listing")
-	flagTrPwd   = flag.String("tp", os.Getenv("TRANSMISSION_PASSWORD"), "Password to access transmissino")
+	flagClient  = flag.String("client", "transmission", "Torrent client type")
+	flagTrURL   = flag.String("tu", "http://localhost:9091", "URL of the torrent client")
+	flagTrUser  = flag.String("tuser", "admin", "User to access the torrent client")
+	flagTrPwd   = flag.String("tp", os.Getenv("TRANSMISSION_PASSWORD"), "Password to access the torrent client")
+	flagEztv    = flag.String("eztv", "", "Comma separated list of eztv base URLs")
 )
 
 func reMatching(r *regexp.Regexp) func(eztv.RSSShow) bool {
@@ -55,7 +64,7 @@ func episodeMatching(e string) func(eztv.RSSShow) bool {
 	return func(s eztv.RSSShow) bool { return s.Episode == eint }
 }
 
-func matching() []eztv.RSSShow {
+func matching(ctx context.Context) []eztv.RSSShow {
 	re := reMatching(regexp.MustCompile(*flagT))
 	season := seasonMatching(*flagS)
 	episode := episodeMatching(*flagE)
@@ -63,22 +72,43 @@ func matching() []eztv.RSSShow {
 		return episode(s) && season(s) && re(s)
 	}
 
-	shows, err := eztv.LastMatchingN(*flagMNum, f)
-	if err != nil {
+	var shows []eztv.RSSShow
+	it := releases(ctx)
+	for len(shows) < *flagMNum && it.Next() {
+		if f(it.Release()) {
+			shows = append(shows, it.Release())
+		}
+	}
+	if err := it.Err(); err != nil {
 		log.Printf("error while getting shows: %v", err)
+	} else if len(shows) < *flagMNum {
+		log.Printf("only %d releases matching your request in %d pages", len(shows), it.Pages())
 	}
 	return shows
 }
 
-func listShows(n int) []eztv.RSSShow {
-	shows, err := eztv.LatestShows(n)
-	if err != nil {
+func listShows(ctx context.Context, n int) []eztv.RSSShow {
+	var shows []eztv.RSSShow
+	it := releases(ctx)
+	for len(shows) < n && it.Next() {
+		shows = append(shows, it.Release())
+	}
+	if err := it.Err(); err != nil {
 		panic(err)
 	}
-
 	return shows
 }
 
+// releases iterates over the latest releases, up to -pages pages and
+// back to -since.
+func releases(ctx context.Context) *eztv.Releases {
+	opts := eztv.ReleaseOptions{MaxPages: *flagPages}
+	if *flagSince > 0 {
+		opts.Since = time.Now().Add(-*flagSince)
+	}
+	return eztv.LatestReleases(ctx, opts)
+}
+
 func getPathFromShow(fname, basepath string) string {
 	re := regexp.MustCompile("(.*)[sS]([0-9]*)[Eex]([0-9]*).*")
 	m := re.FindStringSubmatch(fname)
@@ -90,18 +120,23 @@ func getPathFromShow(fname, basepath string) string {
 
 func main() {
 	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *flagEztv != "" {
+		eztv.DefaultClient = eztv.NewClient(nil, strings.Split(*flagEztv, ",")...)
+	}
 	shows := []eztv.RSSShow{}
 	if *flagList {
-		shows = listShows(*flagN)
+		shows = listShows(ctx, *flagN)
 	} else if *flagSearch {
-		shows = matching()
+		shows = matching(ctx)
 	} else if *flagShow != "" {
 		r, err := regexp.Compile(*flagShow)
 		if err != nil {
 			log.Fatalf("Invalid regexp %q: %v", *flagShow, err)
 		}
 
-		shows, err := eztv.ListShows()
+		shows, err := eztv.ListShows(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -116,29 +151,29 @@ func main() {
 			log.Fatalf("Invalid regexp %q: %v", *flagGetShow, err)
 		}
 
-		shows, err := eztv.ListShows()
+		shows, err := eztv.ListShows(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
 		for _, show := range shows {
 			if r.MatchString(show.Title) {
-				show, err := eztv.GetShow(show.URL)
+				show, err := eztv.GetShow(ctx, show.URL)
 				if err != nil {
 					panic(err)
 				}
 				fmt.Println(show)
 				if *flagAdd > -1 {
-					t, err := tms.NewClient("http://localhost:9091", "admin", *flagTrPwd)
+					d, err := downloader.New(ctx, downloader.Config{Type: *flagClient, URL: *flagTrURL, User: *flagTrUser, Password: *flagTrPwd})
 					if err != nil {
 						panic(err)
 					}
 					episode := show.Episodes[*flagAdd]
 					path := getPathFromShow(episode.Filename(), "/datadisk/anmess/Videos/series")
-					tinfo, err := t.AddTorrentTo(episode.MagnetURL, path)
+					tinfo, err := d.Add(ctx, downloader.AddOptions{URL: episode.MagnetURL, Dir: path})
 					if err != nil {
 						fmt.Printf("ERROR: adding show %s: %v", episode, err)
 					} else {
-						fmt.Printf("Added show %q S%02dE%02d - id %d, downloading in %q", episode.ShowTitle, episode.Season, episode.Episode, tinfo.ID, path)
+						fmt.Printf("Added show %q S%02dE%02d - id %s, downloading in %q", episode.ShowTitle, episode.Season, episode.Episode, tinfo.ID, path)
 					}
 				} else {
 					for i, e := range show.Episodes {
@@ -1,19 +1,31 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"os/user"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/arcimboldo/tv/downloader"
 	"github.com/arcimboldo/tv/eztv"
-	"github.com/arcimboldo/tv/transmission"
+	"github.com/arcimboldo/tv/pathmap"
+	"github.com/arcimboldo/tv/provider"
+	"github.com/arcimboldo/tv/release"
+	"github.com/arcimboldo/tv/selection"
 
 	"gopkg.in/yaml.v2"
 )
@@ -23,39 +35,183 @@ var (
 	flagUpdateAll = flag.Bool("update-all", false, "Update all known shows")
 	flagList      = flag.String("list", "", "List shows. Can be \"local\" or \"all\"")
 	flagShow      = flag.String("show", "", "Show show 'show'")
+	flagStatus    = flag.Bool("status", false, "Show status of the torrents in the torrent client")
 	// options for -show
 	flagUpdate = flag.Bool("update", false, "Update show - requires -show")
 	flagAdd    = flag.String("add", "", "Add the show - requires URL")
 	flagAll    = flag.Bool("all", false, "Update all episodes, not just the newest ones")
 	flagLong   = flag.Bool("l", false, "Long listing")
+	// options for -update-all
+	flagWorkers = flag.Int("workers", 0, "Number of shows updated at the same time, overrides the configuration - requires -update-all")
+	// options for -status
+	flagKick  = flag.Bool("kick", false, "Reannounce stalled downloads and restart failed ones - requires -status")
+	flagDedup = flag.Bool("dedup", false, "Remove duplicate downloads of the same episode - requires -status")
 	// generic options
-	flagQuiet = flag.Bool("q", false, "quieter output")
-	flagF     = flag.String("f", expandUser("~/.ezupdate.yaml"), "Configuration file")
-	dryRun    = flag.Bool("dry-run", false, "Do not actually update")
+	flagQuiet   = flag.Bool("q", false, "quieter output")
+	flagF       = flag.String("f", expandUser("~/.ezupdate.yaml"), "Configuration file")
+	dryRun      = flag.Bool("dry-run", false, "Do not actually update")
+	flagNoCache = flag.Bool("no-cache", false, "Do not use the cache of eztv pages")
+	flagExplain = flag.Bool("explain", false, "Explain the choice among the releases of each episode")
 )
 
 type Config struct {
-	Transmission TrCfg    `yaml:"transmission"`
-	Data         DataCfg  `yaml:"data"`
-	Quality      []string `yaml:"quality"`
-	qualityRE    []*regexp.Regexp
+	Client       downloader.Config `yaml:"client,omitempty"`
+	Transmission TrCfg             `yaml:"transmission"`
+	Eztv         EztvCfg           `yaml:"eztv,omitempty"`
+	Providers    []provider.Config `yaml:"providers,omitempty"`
+	Data         DataCfg           `yaml:"data"`
+	Quality      []string          `yaml:"quality"`
+	selector     *selection.Selector
 	Shows        []ShowCfg `yaml:"shows"`
+	// Timeout of each request to eztv and to the torrent client
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Feeds are RSS or Atom feeds searched for the releases of all the
+	// shows
+	Feeds []string `yaml:"feeds,omitempty"`
+	// Workers is the number of shows updated at the same time by
+	// -update-all
+	Workers int `yaml:"workers,omitempty"`
+	// Selection chooses among the releases of an episode. Its qualities
+	// default to Quality.
+	Selection selection.Policy `yaml:"selection,omitempty"`
+}
+
+// httpClient returns the client used for all the requests.
+func (cfg Config) httpClient() *http.Client {
+	return &http.Client{Timeout: cfg.Timeout}
+}
+
+// clientConfig returns the configuration of the torrent client. The
+// transmission section is used when no client section is given.
+func (cfg Config) clientConfig() downloader.Config {
+	c := cfg.Client
+	if c.Type == "" {
+		c = downloader.Config{
+			Type:     "transmission",
+			URL:      cfg.Transmission.URL,
+			User:     cfg.Transmission.User,
+			Password: cfg.Transmission.Password,
+			Label:    cfg.Transmission.Label,
+		}
+	}
+	c.HTTPClient = cfg.httpClient()
+	return c
+}
+
+// providers returns the configured providers, eztv alone by default,
+// followed by the global feeds.
+func (cfg Config) providers(ctx context.Context) (provider.Set, error) {
+	cfgs := append([]provider.Config(nil), cfg.Providers...)
+	if len(cfgs) == 0 {
+		cfgs = []provider.Config{{Type: "eztv"}}
+	}
+	cfgs = append(cfgs, feedConfigs(cfg.Feeds)...)
+	for i := range cfgs {
+		cfgs[i].HTTPClient = cfg.httpClient()
+	}
+	return provider.NewSet(ctx, cfgs)
+}
+
+func feedConfigs(feeds []string) []provider.Config {
+	var cfgs []provider.Config
+	for _, f := range feeds {
+		cfgs = append(cfgs, provider.Config{Type: "rss", URL: f})
+	}
+	return cfgs
+}
+
+// showProviders returns the providers used for show: the global ones
+// and the feeds of the show.
+func (cfg Config) showProviders(ctx context.Context, ps provider.Set, show string) (provider.Set, error) {
+	feeds := feedConfigs(cfg.showConfig(show).Feeds)
+	if len(feeds) == 0 {
+		return ps, nil
+	}
+	for i := range feeds {
+		feeds[i].HTTPClient = cfg.httpClient()
+	}
+	extra, err := provider.NewSet(ctx, feeds)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(provider.Set{}, ps...), extra...), nil
+}
+
+type EztvCfg struct {
+	// Base URLs of the eztv mirrors, tried in order
+	URLs  []string `yaml:"urls,omitempty"`
+	Cache CacheCfg `yaml:"cache,omitempty"`
+	// Interval is the minimum time between two requests to eztv
+	Interval time.Duration `yaml:"interval"`
+	// Retries of the requests failing with network errors, 429 or 5xx,
+	// waiting from min_backoff to max_backoff between them
+	Retries    int           `yaml:"retries"`
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// policy returns the pace and retries of the requests to eztv.
+func (c EztvCfg) policy() eztv.Policy {
+	return eztv.Policy{Interval: c.Interval, Retries: c.Retries, MinBackoff: c.MinBackoff, MaxBackoff: c.MaxBackoff}
+}
+
+type CacheCfg struct {
+	Disable bool `yaml:"disable,omitempty"`
+	// Dir defaults to the user cache directory
+	Dir string `yaml:"dir,omitempty"`
+	// TTL maps page path prefixes, e.g. /showlist/, to how long they
+	// are cached
+	TTL map[string]time.Duration `yaml:"ttl,omitempty"`
 }
 
 type TrCfg struct {
 	URL      string `yaml:"url"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
+	Label    string `yaml:"label"`
 }
 
 type ShowCfg struct {
 	Title string `yaml:"title"`
 	URL   string `yaml:"url"`
 	Path  string `yaml:"path"`
+	// WatchDir overrides the watch directory of the blackhole client
+	WatchDir string `yaml:"watch_dir,omitempty"`
+	// Feeds are RSS or Atom feeds searched for the releases of the
+	// show, in addition to the global ones
+	Feeds []string `yaml:"feeds,omitempty"`
+	// ImdbID, e.g. tt4158110, selects the show in the eztv API, which is
+	// more reliable than the show page at URL
+	ImdbID string `yaml:"imdb_id,omitempty"`
+}
+
+// showConfig returns the configuration of the tracked show with the
+// given title, if any.
+func (cfg Config) showConfig(title string) ShowCfg {
+	for _, s := range cfg.Shows {
+		if s.Title == title {
+			return s
+		}
+	}
+	return ShowCfg{Title: title}
 }
 
 type DataCfg struct {
-	DefaultPath string `yaml:"default_path"`
+	DefaultPath string      `yaml:"default_path"`
+	PathMap     pathmap.Map `yaml:"path_map"`
+}
+
+// LocalPath returns the library directory as seen by ezupdate.
+// default_path may be given as seen by either side.
+func (d DataCfg) LocalPath() string {
+	p, _ := d.PathMap.ToLocal(d.DefaultPath)
+	return p
+}
+
+// episodePath returns the local directory where the episode is
+// downloaded.
+func (d DataCfg) episodePath(show string, season int) string {
+	return filepath.Join(d.LocalPath(), show, fmt.Sprintf("S%02d", season))
 }
 
 type DownloadedEpisode struct {
@@ -66,7 +222,7 @@ type DownloadedEpisode struct {
 }
 
 func expandUser(path string) string {
-	if path[:2] == "~/" {
+	if strings.HasPrefix(path, "~/") {
 		usr, _ := user.Current()
 		dir := usr.HomeDir
 		path = filepath.Join(dir, path[2:])
@@ -76,9 +232,17 @@ func expandUser(path string) string {
 
 func defaultConfig() Config {
 	return Config{
-		Transmission: TrCfg{URL: "http://localhost:9091", User: "admin"},
+		Transmission: TrCfg{URL: "http://localhost:9091", User: "admin", Label: "tv"},
 		Data:         DataCfg{DefaultPath: expandUser("~/eztv")},
 		Quality:      []string{"1080p", "720p", "HDTV"},
+		Timeout:      time.Minute,
+		Workers:      4,
+		Eztv: EztvCfg{
+			Interval:   eztv.DefaultPolicy.Interval,
+			Retries:    eztv.DefaultPolicy.Retries,
+			MinBackoff: eztv.DefaultPolicy.MinBackoff,
+			MaxBackoff: eztv.DefaultPolicy.MaxBackoff,
+		},
 	}
 }
 
@@ -93,14 +257,15 @@ func ConfigFromFile(fname string) (Config, error) {
 	}
 	err = yaml.Unmarshal(data, &cfg)
 
-	// Build regexps
-	for _, q := range cfg.Quality {
-		r, err := regexp.Compile(q)
-		if err != nil {
-			return cfg, err
-		}
-		cfg.qualityRE = append(cfg.qualityRE, r)
+	policy := cfg.Selection
+	if len(policy.Qualities) == 0 {
+		policy.Qualities = cfg.Quality
 	}
+	selector, serr := selection.New(policy)
+	if serr != nil {
+		return cfg, serr
+	}
+	cfg.selector = selector
 
 	return cfg, err
 }
@@ -114,10 +279,14 @@ func SaveConfig(cfg Config, fname string) error {
 	urls := make(map[string]ShowCfg)
 
 	for _, s := range cfg.Shows {
-		if _, ok := urls[s.URL]; !ok {
-			urls[s.URL] = s
+		key := s.URL
+		if key == "" {
+			key = s.ImdbID
+		}
+		if _, ok := urls[key]; !ok {
+			urls[key] = s
 		} else {
-			log.Printf("Warning: duplicate entry %s", s.URL)
+			log.Printf("Warning: duplicate entry %s", key)
 		}
 	}
 	cfg.Shows = []ShowCfg{}
@@ -141,12 +310,45 @@ func SaveConfig(cfg Config, fname string) error {
 	return ioutil.WriteFile(fname, out, mode)
 }
 
-func getShow(s string, cfg Config) ([]eztv.Show, bool, error) {
+// fetchShow gets a tracked show by its IMDb id if known, falling back
+// to its page. The title of the configuration is kept, as it names the
+// directory of the show.
+func fetchShow(ctx context.Context, ps provider.Set, s ShowCfg) (eztv.Show, error) {
+	var show eztv.Show
+	err := fmt.Errorf("show %q has neither url nor imdb_id", s.Title)
+	if s.ImdbID != "" {
+		show, err = ps.GetShowByImdbID(ctx, s.ImdbID)
+		if err != nil && s.URL != "" {
+			log.Printf("error while getting show %s by IMDb id %s, using %s: %v", s.Title, s.ImdbID, s.URL, err)
+		}
+	}
+	if err != nil && s.URL != "" {
+		show, err = ps.GetShow(ctx, s.URL)
+	}
+	if err != nil {
+		return show, err
+	}
+	if s.Title != "" {
+		show.Title = s.Title
+		for _, e := range show.Episodes {
+			e.ShowTitle = s.Title
+		}
+	}
+	if s.URL != "" {
+		show.URL = s.URL
+	}
+	if show.ImdbID == "" {
+		show.ImdbID = s.ImdbID
+	}
+	return show, nil
+}
+
+func getShow(ctx context.Context, ps provider.Set, s string, cfg Config) ([]eztv.Show, bool, error) {
 	// Search local show
 	found := []eztv.Show{}
 	for _, show := range cfg.Shows {
-		if *flagShow == show.Title || *flagShow == show.URL {
-			eztvShow, err := eztv.GetShow(show.URL)
+		if s == show.Title || eztv.SamePage(s, show.URL) || (show.ImdbID != "" && s == show.ImdbID) {
+			eztvShow, err := fetchShow(ctx, ps, show)
 			if err != nil {
 				return found, false, err
 			}
@@ -160,15 +362,18 @@ func getShow(s string, cfg Config) ([]eztv.Show, bool, error) {
 		return found, true, nil
 	}
 
-	shows, err := eztv.ListShows()
+	shows, err := ps.ListShows(ctx)
 	if err != nil {
-		return found, false, err
+		if len(shows) == 0 {
+			return found, false, err
+		}
+		log.Printf("error while listing shows: %v", err)
 	}
 	r := regexp.MustCompile(fmt.Sprintf("(?i)%s", s))
 
 	for _, show := range shows {
-		if s == show.Title || s == show.URL || r.MatchString(show.Title) {
-			match, err := eztv.GetShow(show.URL)
+		if s == show.Title || eztv.SamePage(s, show.URL) || r.MatchString(show.Title) {
+			match, err := ps.GetShow(ctx, show.URL)
 			if err != nil {
 				log.Printf("error while getting show %s: %v", show.URL, err)
 			}
@@ -190,24 +395,263 @@ func getShow(s string, cfg Config) ([]eztv.Show, bool, error) {
 
 }
 
-func updateShow(show eztv.Show, cfg Config, all bool) error {
-	var t *transmission.Transmission
-	var err error
-	if !*dryRun {
-		t, err = transmission.NewClient(cfg.Transmission.URL, cfg.Transmission.User, cfg.Transmission.Password)
+// addEpisode adds the episode to the torrent client, downloading it in
+// the local directory path and labelling it after the show, and paused
+// if paused is true. The directory is created only if it is not mapped
+// to a remote path.
+func addEpisode(ctx context.Context, d downloader.Downloader, e eztv.Episode, path string, cfg Config, paused bool) (downloader.Torrent, error) {
+	remote, mapped := cfg.Data.PathMap.ToRemote(path)
+	if !mapped {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return downloader.Torrent{}, err
+		}
+	}
+	opts := downloader.AddOptions{
+		URL:      e.DownloadURL(),
+		Dir:      remote,
+		Name:     e.Filename(),
+		WatchDir: cfg.showConfig(e.ShowTitle).WatchDir,
+		Paused:   paused,
 	}
+	if opts.Name == "." {
+		// no torrent URL to take the name from
+		opts.Name = e.Title
+	}
+	if label := cfg.clientConfig().Label; label != "" {
+		opts.Labels = []string{label + "/" + e.ShowTitle}
+	}
+	return d.Add(ctx, opts)
+}
+
+// downloadedAll returns true if all the episodes of the release e are
+// among the downloaded ones.
+func downloadedAll(downloaded map[int]map[int]string, e eztv.Episode) bool {
+	for _, n := range e.Numbers() {
+		if _, ok := downloaded[e.Season][n]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// bestRelease returns the release to download among eps, all of the
+// same episode, or false if all of them are rejected. With -explain the
+// score of each release is printed.
+func bestRelease(eps []eztv.Episode, cfg Config, res *showResult) (eztv.Episode, bool) {
+	ranked := cfg.selector.Rank(eps)
+	if *flagExplain && len(ranked) > 0 {
+		res.printf("%s %s:\n", ranked[0].Episode.ShowTitle, ranked[0].Episode.Number())
+		for i, c := range ranked {
+			mark := " "
+			if i == 0 && !c.Rejected {
+				mark = "*"
+			}
+			res.printf("  %s %s\n", mark, c.Explain())
+		}
+	}
+	if len(ranked) == 0 || ranked[0].Rejected {
+		return eztv.Episode{}, false
+	}
+	return ranked[0].Episode, true
+}
+
+// How long addPack waits for the metadata of a magnet link before
+// giving up selecting the files, and how often it asks the client.
+var (
+	metadataTimeout = 2 * time.Minute
+	metadataPoll    = 2 * time.Second
+)
+
+// usePack returns true if a pack should replace the missing episodes of
+// a season with the given number of known episodes, released or
+// downloaded: when most of them are missing, or when the season is only
+// known from the pack.
+func usePack(known, missing int) bool {
+	return known == 0 || (missing >= 2 && missing*2 > known)
+}
+
+// addPack adds the season pack p, downloading only the files of the
+// wanted episodes when the client can select files. All the files are
+// downloaded if wanted is empty. It returns false if the pack was not
+// added.
+func addPack(ctx context.Context, d downloader.Downloader, p eztv.Episode, wanted []int, cfg Config, res *showResult) bool {
+	path := cfg.Data.episodePath(p.ShowTitle, p.Season)
+	episodes := "all the episodes"
+	if len(wanted) > 0 {
+		episodes = fmt.Sprintf("episodes %v", wanted)
+	}
+	queued := len(wanted)
+	if queued == 0 {
+		queued = 1
+	}
+	if d == nil {
+		res.printf("dry-run: adding pack %s for %s to %s\n", p, episodes, path)
+		res.Queued += queued
+		return true
+	}
+	fs, canSelect := d.(downloader.FileSelector)
+	st, canStart := d.(downloader.Starter)
+	// the pack is added paused, so that the unwanted files do not start
+	// downloading before they are deselected
+	selectFiles := len(wanted) > 0 && canSelect && canStart
+	tinfo, err := addEpisode(ctx, d, p, path, cfg, selectFiles)
 	if err != nil {
-		return err
+		res.errorf("adding pack %s: %v", p, err)
+		return false
+	}
+	res.printf("Added pack %q %s for %s - id %s, downloading in %q\n", p.ShowTitle, p.Number(), episodes, tinfo.ID, path)
+	res.Queued += queued
+	if len(wanted) == 0 {
+		return true
+	}
+	if !selectFiles {
+		res.printf("WARNING: %s cannot select files, downloading the whole pack %s\n", cfg.clientConfig().Type, p.Title)
+		return true
+	}
+
+	started := false
+	start := func() {
+		if err := st.Start(ctx, tinfo.ID); err != nil {
+			res.errorf("starting pack %s: %v", p, err)
+		}
+		started = true
+	}
+	files, err := fs.Files(ctx, tinfo.ID)
+	if err == nil && len(files) == 0 {
+		// the metadata of magnet links is only fetched by running
+		// torrents
+		start()
+		files, err = waitFiles(ctx, fs, tinfo.ID)
+	}
+	if err == nil {
+		if selected := episodeFiles(files, p.Season, wanted); len(selected) > 0 {
+			err = fs.SelectFiles(ctx, tinfo.ID, selected)
+		} else {
+			err = fmt.Errorf("no file matches the episodes, downloading all the files")
+		}
 	}
-	downloaded := show.GetDownloadedEpisodes(cfg.Data.DefaultPath)
 	if err != nil {
-		return fmt.Errorf("unable to get list of existing episodes: %v", err)
+		res.errorf("selecting the files of pack %s: %v", p, err)
+	}
+	if !started {
+		start()
 	}
+	return true
+}
+
+// waitFiles returns the files of the torrent id, waiting for the client
+// to fetch the metadata of magnet links.
+func waitFiles(ctx context.Context, fs downloader.FileSelector, id string) ([]downloader.File, error) {
+	wait, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	for {
+		files, err := fs.Files(wait, id)
+		if err != nil || len(files) > 0 {
+			return files, err
+		}
+		select {
+		case <-wait.Done():
+			return nil, fmt.Errorf("no metadata after %v, downloading all the files", metadataTimeout)
+		case <-time.After(metadataPoll):
+		}
+	}
+}
+
+// episodeFiles returns the indexes of the files with the wanted episodes
+// of season, skipping the samples.
+func episodeFiles(files []downloader.File, season int, wanted []int) []int {
+	want := make(map[int]bool)
+	for _, e := range wanted {
+		want[e] = true
+	}
+	var selected []int
+	for i, f := range files {
+		if strings.Contains(strings.ToLower(f.Name), "sample") {
+			continue
+		}
+		var e eztv.Episode
+		e.SetRelease(release.Parse(path.Base(f.Name)))
+		if e.Season != season {
+			continue
+		}
+		for _, n := range e.Numbers() {
+			if want[n] {
+				selected = append(selected, i)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// showResult is the outcome of the update of a show.
+type showResult struct {
+	Title   string
+	Fetched int // releases found for the show
+	Queued  int // episodes added to the torrent client
+	Errors  []error
+	// out collects the messages of the update, printed at once so that
+	// the output of concurrent updates does not interleave
+	out bytes.Buffer
+}
+
+func (r *showResult) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&r.out, format, args...)
+}
+
+// errorf records an error and reports it in the output.
+func (r *showResult) errorf(format string, args ...interface{}) {
+	err := fmt.Errorf(format, args...)
+	r.Errors = append(r.Errors, err)
+	r.printf("ERROR: %v\n", err)
+}
+
+// updateShow adds the missing episodes of the show to d, choosing among
+// the releases of all the providers. d is nil with -dry-run.
+func updateShow(ctx context.Context, ps provider.Set, d downloader.Downloader, show eztv.Show, cfg Config, all bool) *showResult {
+	res := &showResult{Title: show.Title}
+	ps, err := cfg.showProviders(ctx, ps, show.Title)
+	if err != nil {
+		res.errorf("%s: %v", show.Title, err)
+		return res
+	}
+	if err := ps.Complete(ctx, &show); err != nil {
+		res.printf("WARNING: searching releases of %s: %v\n", show.Title, err)
+	}
+	res.Fetched = len(show.Episodes)
+	downloaded := show.GetDownloadedEpisodes(cfg.Data.LocalPath())
 
 	latest := show.LatestEpisode()
 
 	toAdd := make(map[int]map[int][]eztv.Episode)
+	packs := make(map[int][]eztv.Episode)
+	// known are the episodes of each season, released or downloaded
+	known := make(map[int]map[int]bool)
+	for s, eps := range downloaded {
+		known[s] = make(map[int]bool)
+		for e := range eps {
+			known[s][e] = true
+		}
+	}
 	for _, e := range show.Episodes {
+		if e.Pack {
+			// packs of several seasons are too big to replace the
+			// episodes of one
+			if len(e.Seasons) <= 1 && (all || e.Season >= latest.Season) {
+				packs[e.Season] = append(packs[e.Season], *e)
+			}
+			continue
+		}
+		if e.Season < 0 || e.Episode < 0 {
+			// e.g. parts of seasons
+			continue
+		}
+		if _, ok := known[e.Season]; !ok {
+			known[e.Season] = make(map[int]bool)
+		}
+		for _, n := range e.Numbers() {
+			known[e.Season][n] = true
+		}
 
 		if e.Downloaded {
 			continue
@@ -215,10 +659,8 @@ func updateShow(show eztv.Show, cfg Config, all bool) error {
 		if !all && !(e.Season >= latest.Season && e.Episode >= latest.Episode) {
 			continue
 		}
-		if _, ok := downloaded[e.Season]; ok {
-			if _, ok := downloaded[e.Season][e.Episode]; ok {
-				continue
-			}
+		if downloadedAll(downloaded, *e) {
+			continue
 		}
 
 		if _, ok := toAdd[e.Season]; !ok {
@@ -228,34 +670,221 @@ func updateShow(show eztv.Show, cfg Config, all bool) error {
 		toAdd[e.Season][e.Episode] = append(toAdd[e.Season][e.Episode], *e)
 	}
 
+	for s, candidates := range packs {
+		missing := toAdd[s]
+		if !usePack(len(known[s]), len(missing)) {
+			continue
+		}
+		var wanted []int
+		for e := range missing {
+			wanted = append(wanted, e)
+		}
+		sort.Ints(wanted)
+		pack, ok := bestRelease(candidates, cfg, res)
+		if ok && addPack(ctx, d, pack, wanted, cfg, res) {
+			delete(toAdd, s)
+		}
+	}
+
 	for s := range toAdd {
 		for e := range toAdd[s] {
-			var bestMatch eztv.Episode
-			for _, ep := range toAdd[s][e] {
-				if bestMatch.MagnetURL == "" {
-					bestMatch = ep
+			bestMatch, ok := bestRelease(toAdd[s][e], cfg, res)
+			if !ok {
+				res.printf("No acceptable release of %s %s\n", show.Title, toAdd[s][e][0].Number())
+				continue
+			}
+
+			path := cfg.Data.episodePath(show.Title, bestMatch.Season)
+			if d == nil {
+				res.printf("dry-run: adding episode %s to %s\n", bestMatch, path)
+				res.Queued++
+			} else {
+				tinfo, err := addEpisode(ctx, d, bestMatch, path, cfg, false)
+				if err != nil {
+					res.errorf("adding show %s: %v", bestMatch, err)
 				} else {
-					for _, re := range cfg.qualityRE {
-						if re.MatchString(ep.Title) || re.MatchString(ep.TorrentURL) {
-							bestMatch = ep
-							break
-						}
-					}
+					res.printf("Added show %q %s - id %s, downloading in %q\n", bestMatch.ShowTitle, bestMatch.Number(), tinfo.ID, path)
+					res.Queued++
 				}
 			}
+		}
+	}
+	return res
+}
 
-			path := filepath.Join(cfg.Data.DefaultPath, show.Title, fmt.Sprintf("S%02d", bestMatch.Season))
-			if *dryRun {
-				log.Printf("dry-run: adding episode %s to %s\n", bestMatch, path)
-			} else {
-				tinfo, err := t.AddTorrentTo(bestMatch.MagnetURL, path)
+// updateAll fetches and updates the shows of the configuration with the
+// given number of workers. The output of each show is written to w when
+// its update is done, and the results are returned in the order of the
+// shows.
+func updateAll(ctx context.Context, w io.Writer, ps provider.Set, d downloader.Downloader, cfg Config, workers int) []*showResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]*showResult, len(cfg.Shows))
+	jobs := make(chan int)
+	done := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				s := cfg.Shows[i]
+				show, err := fetchShow(ctx, ps, s)
 				if err != nil {
-					fmt.Printf("ERROR: adding show %s: %v\n", bestMatch, err)
+					results[i] = &showResult{Title: s.Title}
+					results[i].errorf("getting show %s: %v", s.Title, err)
 				} else {
-					fmt.Printf("Added show %q S%02dE%02d - id %d, downloading in %q\n", bestMatch.ShowTitle, bestMatch.Season, bestMatch.Episode, tinfo.ID, path)
+					results[i] = updateShow(ctx, ps, d, show, cfg, *flagAll)
+					results[i].Title = s.Title
 				}
+				done <- i
 			}
+		}()
+	}
+	go func() {
+		for i := range cfg.Shows {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+	for i := range done {
+		w.Write(results[i].out.Bytes())
+	}
+	return results
+}
+
+// printSummary writes the totals of the update, and the errors of the
+// failed shows, to w. It returns the number of failed shows.
+func printSummary(w io.Writer, results []*showResult) int {
+	var fetched, queued, failed int
+	for _, r := range results {
+		fetched += r.Fetched
+		queued += r.Queued
+		if len(r.Errors) > 0 {
+			failed++
 		}
+		if *flagLong {
+			fmt.Fprintf(w, "%-40s %5d releases %3d queued %3d errors\n", r.Title, r.Fetched, r.Queued, len(r.Errors))
+		}
+	}
+	if !*flagQuiet || failed > 0 {
+		fmt.Fprintf(w, "Updated %d shows: %d releases, %d episodes queued, %d shows failed\n", len(results), fetched, queued, failed)
+	}
+	for _, r := range results {
+		for _, err := range r.Errors {
+			fmt.Fprintf(w, "FAILED %s: %v\n", r.Title, err)
+		}
+	}
+	return failed
+}
+
+// kickStalled reannounces downloads that have no peers and restarts
+// torrents stopped because of an error, when the client supports it.
+func kickStalled(ctx context.Context, d downloader.Downloader, torrents []downloader.Torrent, cfg Config) error {
+	var stalled, failed []string
+	for _, tr := range torrents {
+		if tr.Done() {
+			continue
+		}
+		switch {
+		case tr.State == downloader.StateError:
+			failed = append(failed, tr.ID)
+		case tr.State == downloader.StateDownloading && tr.DownloadRate == 0 && tr.Peers == 0:
+			stalled = append(stalled, tr.ID)
+		}
+	}
+	if *dryRun {
+		log.Printf("dry-run: reannouncing %v, restarting %v", stalled, failed)
+		return nil
+	}
+	if len(stalled) > 0 {
+		r, ok := d.(downloader.Reannouncer)
+		if !ok {
+			return fmt.Errorf("client %s cannot reannounce torrents", cfg.clientConfig().Type)
+		}
+		if err := r.Reannounce(ctx, stalled...); err != nil {
+			return err
+		}
+		fmt.Printf("Reannounced %d stalled torrents\n", len(stalled))
+	}
+	if len(failed) > 0 {
+		st, ok := d.(downloader.Starter)
+		if !ok {
+			return fmt.Errorf("client %s cannot start torrents", cfg.clientConfig().Type)
+		}
+		if err := st.Start(ctx, failed...); err != nil {
+			return err
+		}
+		fmt.Printf("Restarted %d failed torrents\n", len(failed))
+	}
+	return nil
+}
+
+// inDir returns true if path is dir or one of its subdirectories.
+func inDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// removeDuplicates removes torrents downloading an episode that is
+// already being downloaded in the same directory of the library. The most
+// complete one is kept. The data of the removed torrents is deleted too,
+// unless it has the same name as the one of the kept torrent. When label
+// is set only the torrents added by ezupdate, labelled with it, are
+// considered.
+func removeDuplicates(ctx context.Context, d downloader.Downloader, torrents []downloader.Torrent, data DataCfg, label string) error {
+	basedir := data.LocalPath()
+	keys := make(map[string]string)
+	best := make(map[string]downloader.Torrent)
+	for _, tr := range torrents {
+		dir, _ := data.PathMap.ToLocal(tr.Dir)
+		if !inDir(dir, basedir) || (label != "" && !tr.HasLabel(label)) {
+			continue
+		}
+		r := release.Parse(tr.Name)
+		if r.Season < 0 || r.Episode < 0 {
+			continue
+		}
+		key := fmt.Sprintf("%s/%d/%d", dir, r.Season, r.Episode)
+		keys[tr.ID] = key
+		if prev, ok := best[key]; !ok || tr.Progress > prev.Progress {
+			best[key] = tr
+		}
+	}
+	var dups, shared []string
+	for _, tr := range torrents {
+		key, ok := keys[tr.ID]
+		if !ok || best[key].ID == tr.ID {
+			continue
+		}
+		if tr.Done() {
+			// never delete completed downloads
+			continue
+		}
+		fmt.Printf("Duplicate torrent %s %s\n", tr.ID, tr.Name)
+		if tr.Name == best[key].Name {
+			shared = append(shared, tr.ID)
+		} else {
+			dups = append(dups, tr.ID)
+		}
+	}
+	if len(dups)+len(shared) == 0 {
+		return nil
+	}
+	if *dryRun {
+		log.Printf("dry-run: not removing %d duplicates", len(dups)+len(shared))
+		return nil
+	}
+	if len(shared) > 0 {
+		if err := d.Remove(ctx, false, shared...); err != nil {
+			return err
+		}
+	}
+	if len(dups) > 0 {
+		return d.Remove(ctx, true, dups...)
 	}
 	return nil
 }
@@ -270,6 +899,15 @@ func main() {
 	}
 	defer SaveConfig(cfg, fname)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	eztv.DefaultClient = eztv.NewClient(cfg.httpClient(), cfg.Eztv.URLs...)
+	eztv.DefaultClient.SetPolicy(cfg.Eztv.policy())
+	if !cfg.Eztv.Cache.Disable && !*flagNoCache {
+		if err := eztv.DefaultClient.EnableCache(expandUser(cfg.Eztv.Cache.Dir), cfg.Eztv.Cache.TTL); err != nil {
+			log.Printf("not caching eztv pages: %v", err)
+		}
+	}
 	// Check mutually exclusive options
 	cmds := 0
 	if *flagList != "" {
@@ -281,8 +919,50 @@ func main() {
 	if *flagUpdateAll {
 		cmds++
 	}
+	if *flagStatus {
+		cmds++
+	}
 	if cmds != 1 {
-		log.Fatalf("Exactly one of -update-all, -list -show, add options must be given")
+		log.Fatalf("Exactly one of -update-all, -list, -show, -status options must be given")
+	}
+
+	// only the commands querying the providers build them
+	var providers provider.Set
+	if *flagList == "all" || *flagShow != "" || *flagUpdateAll {
+		providers, err = cfg.providers(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *flagStatus {
+		d, err := downloader.New(ctx, cfg.clientConfig())
+		if err != nil {
+			log.Fatal(err)
+		}
+		torrents, err := d.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, tr := range torrents {
+			fmt.Printf("%.8s %-12s %5.1f%% %s\n", tr.ID, tr.State, tr.Progress*100, tr.Name)
+			if tr.Error != "" {
+				fmt.Printf("         error: %s\n", tr.Error)
+			}
+			if *flagLong {
+				fmt.Printf("         dir: %s down: %dB/s up: %dB/s peers: %d\n", tr.Dir, tr.DownloadRate, tr.UploadRate, tr.Peers)
+			}
+		}
+		if *flagDedup {
+			if err := removeDuplicates(ctx, d, torrents, cfg.Data, cfg.clientConfig().Label); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *flagKick {
+			if err := kickStalled(ctx, d, torrents, cfg); err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
 
 	if *flagList != "" {
@@ -294,7 +974,7 @@ func main() {
 				fmt.Printf("l %-40s %s\n", show.Title, show.URL)
 			}
 			if *flagList == "all" {
-				shows, err := eztv.ListShows()
+				shows, err := providers.ListShows(ctx)
 				if err != nil {
 					log.Fatal(err)
 				}
@@ -311,7 +991,7 @@ func main() {
 	// Show show or update show
 	if *flagShow != "" {
 		// is in the config?
-		shows, local, err := getShow(*flagShow, cfg)
+		shows, local, err := getShow(ctx, providers, *flagShow, cfg)
 		if err != nil {
 			log.Fatalf("Error while getting show %q: %v", *flagShow, err)
 		}
@@ -320,19 +1000,17 @@ func main() {
 			fmt.Println(show)
 		}
 
-		downloaded := show.GetDownloadedEpisodes(cfg.Data.DefaultPath)
+		downloaded := show.GetDownloadedEpisodes(cfg.Data.LocalPath())
 		for _, e := range show.Episodes {
-			if _, ok := downloaded[e.Season]; ok {
-				if _, ok := downloaded[e.Season][e.Episode]; ok {
-					if !*flagQuiet {
-						if e.Downloaded {
-							fmt.Printf("d %s - %s\n", e, e.FullPath(cfg.Data.DefaultPath))
-						} else {
-							fmt.Printf("+ %s - %s\n", e, e.TorrentURL)
-						}
+			if downloadedAll(downloaded, *e) {
+				if !*flagQuiet {
+					if e.Downloaded {
+						fmt.Printf("d %s - %s\n", e, e.FullPath(cfg.Data.LocalPath()))
+					} else {
+						fmt.Printf("+ %s - %s\n", e, e.TorrentURL)
 					}
-					continue
 				}
+				continue
 			}
 			if !*flagQuiet {
 				fmt.Printf("  %s - %s\n", e, e.TorrentURL)
@@ -340,16 +1018,26 @@ func main() {
 		}
 		if *flagUpdate {
 			if !local {
-				cfg.Shows = append(cfg.Shows, ShowCfg{Title: show.Title, URL: show.URL})
+				cfg.Shows = append(cfg.Shows, ShowCfg{Title: show.Title, URL: show.URL, ImdbID: show.ImdbID})
 			}
 
-			err = updateShow(show, cfg, *flagAll)
-			if err != nil {
-				log.Fatalf("Error while updating show %s: %v", show.Title, err)
+			var d downloader.Downloader
+			if !*dryRun {
+				d, err = downloader.New(ctx, cfg.clientConfig())
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			res := updateShow(ctx, providers, d, show, cfg, *flagAll)
+			os.Stdout.Write(res.out.Bytes())
+			if len(res.Errors) > 0 {
+				// os.Exit skips the deferred calls
+				SaveConfig(cfg, fname)
+				os.Exit(1)
 			}
 		}
 		if *flagAdd != "" {
-			shows, _, err := getShow(*flagShow, cfg)
+			shows, _, err := getShow(ctx, providers, *flagShow, cfg)
 			if err != nil {
 				log.Fatalf("Error while getting show %q: %v", *flagShow, err)
 			}
@@ -370,40 +1058,38 @@ func main() {
 				log.Fatalf("Torrent %s not found for show %s", *flagAdd, show.Title)
 			}
 			if !*dryRun {
-				path := filepath.Join(cfg.Data.DefaultPath, show.Title, fmt.Sprintf("S%02d", e.Season))
-				t, err := transmission.NewClient(cfg.Transmission.URL, cfg.Transmission.User, cfg.Transmission.Password)
-				tinfo, err := t.AddTorrentTo(e.MagnetURL, path)
+				path := cfg.Data.episodePath(show.Title, e.Season)
+				d, err := downloader.New(ctx, cfg.clientConfig())
+				if err != nil {
+					log.Fatal(err)
+				}
+				tinfo, err := addEpisode(ctx, d, *e, path, cfg, false)
 				if err != nil {
 					fmt.Printf("ERROR: adding show %s: %v\n", e, err)
 				} else {
-					fmt.Printf("Added show %q S%02dE%02d - id %d, downloading in %q\n", e.ShowTitle, e.Season, e.Episode, tinfo.ID, path)
+					fmt.Printf("Added show %q %s - id %s, downloading in %q\n", e.ShowTitle, e.Number(), tinfo.ID, path)
 				}
 			}
 		}
 	}
 
 	if *flagUpdateAll {
-		var wg sync.WaitGroup
-		wg.Add(len(cfg.Shows))
-
-		for _, s := range cfg.Shows {
-			go func(s ShowCfg) {
-				defer wg.Done()
-				if !*flagQuiet {
-					log.Printf("getting show %s (%s)", s.Title, s.URL)
-				}
-				shows, _, err := getShow(s.URL, cfg)
-				if err != nil {
-					log.Printf("error while getting show with url %s: %v", s.URL, err)
-					return
-				}
-				show := shows[0]
-				err = updateShow(show, cfg, *flagAll)
-				if err != nil {
-					log.Printf("Error while updating show %s: %v", show.Title, err)
-				}
-			}(s)
+		var d downloader.Downloader
+		if !*dryRun {
+			d, err = downloader.New(ctx, cfg.clientConfig())
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		workers := cfg.Workers
+		if *flagWorkers > 0 {
+			workers = *flagWorkers
+		}
+		results := updateAll(ctx, os.Stdout, providers, d, cfg, workers)
+		if printSummary(os.Stdout, results) > 0 {
+			// os.Exit skips the deferred calls
+			SaveConfig(cfg, fname)
+			os.Exit(1)
 		}
-		wg.Wait()
 	}
 }
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arcimboldo/tv/downloader"
+	"github.com/arcimboldo/tv/eztv"
+	"github.com/arcimboldo/tv/provider"
+	"github.com/arcimboldo/tv/release"
+	"github.com/arcimboldo/tv/selection"
+)
+
+// fakeDownloader records the torrents added and removed.
+type fakeDownloader struct {
+	mu      sync.Mutex
+	added   []downloader.AddOptions
+	removed map[bool][]string // by deleteData
+}
+
+func (f *fakeDownloader) Add(ctx context.Context, opts downloader.AddOptions) (downloader.Torrent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.added = append(f.added, opts)
+	return downloader.Torrent{ID: opts.URL, Name: opts.Name}, nil
+}
+
+func (f *fakeDownloader) Status(ctx context.Context, ids ...string) ([]downloader.Torrent, error) {
+	return nil, nil
+}
+
+func (f *fakeDownloader) Remove(ctx context.Context, deleteData bool, ids ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.removed == nil {
+		f.removed = make(map[bool][]string)
+	}
+	f.removed[deleteData] = append(f.removed[deleteData], ids...)
+	return nil
+}
+
+func (f *fakeDownloader) Move(ctx context.Context, dir string, ids ...string) error {
+	return nil
+}
+
+func TestRemoveDuplicates(t *testing.T) {
+	dir := "/tv/Show/S01"
+	labels := []string{"tv/Show"}
+	torrents := []downloader.Torrent{
+		{ID: "a", Name: "Show.S01E01.720p.HDTV.x264-A", Dir: dir, Progress: 0.5, Labels: labels},
+		{ID: "b", Name: "Show 1x01 1920x1080", Dir: dir, Progress: 0.2, Labels: labels},
+		{ID: "c", Name: "Show.S01E01.720p.HDTV.x264-A", Dir: dir, Progress: 0.1, Labels: labels},
+		{ID: "d", Name: "Show.S01E02.1920x1080", Dir: dir, Progress: 0.1, Labels: labels},
+		{ID: "e", Name: "Show.S01E03.720p", Dir: dir, Progress: 1, Labels: labels},
+		{ID: "f", Name: "Show.S01E03.1080p", Dir: dir, Progress: 1, Labels: labels},
+		{ID: "g", Name: "Show.S01E01.1080p", Dir: "/tv/Other/S01", Progress: 0.1, Labels: labels},
+		{ID: "h", Name: "Show.S01E01.1080p", Dir: "/elsewhere", Progress: 0.1, Labels: labels},
+		// /tv2 is not in the library /tv
+		{ID: "i", Name: "Show.S01E01.1080p", Dir: "/tv2/Show/S01", Progress: 0.3, Labels: labels},
+		{ID: "j", Name: "Show.S01E01.480p", Dir: "/tv2/Show/S01", Progress: 0.1, Labels: labels},
+		// not added by ezupdate
+		{ID: "k", Name: "Show.S01E02.720p", Dir: dir, Progress: 0.05},
+		{ID: "l", Name: "Show.S01E02.480p", Dir: dir, Progress: 0.01, Labels: []string{"other"}},
+	}
+	tests := []struct {
+		label  string
+		expect map[bool][]string
+	}{
+		{"tv", map[bool][]string{true: {"b"}, false: {"c"}}},
+		// without labels all the torrents of the library are considered
+		{"", map[bool][]string{true: {"b", "k", "l"}, false: {"c"}}},
+	}
+	for _, test := range tests {
+		d := &fakeDownloader{}
+		if err := removeDuplicates(context.Background(), d, torrents, DataCfg{DefaultPath: "/tv"}, test.label); err != nil {
+			t.Fatal(err)
+		}
+		for _, ids := range d.removed {
+			sort.Strings(ids)
+		}
+		if !reflect.DeepEqual(d.removed, test.expect) {
+			t.Errorf("label %q: expected removed %v, got %v", test.label, test.expect, d.removed)
+		}
+	}
+}
+
+// fakeSelector is a client able to select files and start torrents. It
+// records the calls, and has the metadata of the torrents after
+// metadataAfter calls to Files.
+type fakeSelector struct {
+	fakeDownloader
+	files         []downloader.File
+	metadataAfter int
+	calls         []string
+}
+
+func (f *fakeSelector) Add(ctx context.Context, opts downloader.AddOptions) (downloader.Torrent, error) {
+	f.calls = append(f.calls, fmt.Sprintf("add paused=%v", opts.Paused))
+	return f.fakeDownloader.Add(ctx, opts)
+}
+
+func (f *fakeSelector) Files(ctx context.Context, id string) ([]downloader.File, error) {
+	f.calls = append(f.calls, "files")
+	if f.metadataAfter > 0 {
+		f.metadataAfter--
+		return nil, nil
+	}
+	return f.files, nil
+}
+
+func (f *fakeSelector) SelectFiles(ctx context.Context, id string, wanted []int) error {
+	f.calls = append(f.calls, fmt.Sprintf("select %v", wanted))
+	return nil
+}
+
+func (f *fakeSelector) Start(ctx context.Context, ids ...string) error {
+	f.calls = append(f.calls, "start")
+	return nil
+}
+
+func (f *fakeSelector) Stop(ctx context.Context, ids ...string) error {
+	return nil
+}
+
+func TestUsePack(t *testing.T) {
+	tests := []struct {
+		known, missing int
+		expect         bool
+	}{
+		{0, 0, true},
+		{10, 0, false},
+		{10, 1, false},
+		{2, 2, true},
+		{10, 5, false},
+		{10, 6, true},
+		{3, 1, false},
+	}
+	for _, test := range tests {
+		if got := usePack(test.known, test.missing); got != test.expect {
+			t.Errorf("usePack(%d, %d) = %v, expected %v", test.known, test.missing, got, test.expect)
+		}
+	}
+}
+
+func TestEpisodeFiles(t *testing.T) {
+	files := []downloader.File{
+		{Name: "Show.S02.1080p/Show.S02E01.1080p.WEB.x264-GRP.mkv"},
+		{Name: "Show.S02.1080p/Show.S02E02.1080p.WEB.x264-GRP.mkv"},
+		{Name: "Show.S02.1080p/Show.S02E03E04.1080p.WEB.x264-GRP.mkv"},
+		{Name: "Show.S02.1080p/Sample/Show.S02E02.sample.mkv"},
+		{Name: "Show.S02.1080p/Show.S01E02.Recap.mkv"},
+		{Name: "Show.S02.1080p/Show.S02.nfo"},
+	}
+	tests := []struct {
+		season int
+		wanted []int
+		expect []int
+	}{
+		{2, []int{2}, []int{1}},
+		{2, []int{1, 4}, []int{0, 2}},
+		{2, []int{5}, nil},
+		{1, []int{2}, []int{4}},
+		{3, []int{1}, nil},
+	}
+	for _, test := range tests {
+		if got := episodeFiles(files, test.season, test.wanted); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("season %d episodes %v: expected files %v, got %v", test.season, test.wanted, test.expect, got)
+		}
+	}
+}
+
+func TestAddPack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ezupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(poll time.Duration) { metadataPoll = poll }(metadataPoll)
+	metadataPoll = time.Millisecond
+
+	cfg := Config{Data: DataCfg{DefaultPath: dir}}
+	pack := eztv.Episode{Title: "Show.S01.720p", ShowTitle: "Show", Season: 1, Episode: -1, Pack: true, MagnetURL: "magnet:?xt=urn:btih:abcd"}
+	files := []downloader.File{{Name: "Show.S01E01.mkv"}, {Name: "Show.S01E02.mkv"}, {Name: "Show.S01E03.mkv"}}
+	tests := []struct {
+		name          string
+		wanted        []int
+		metadataAfter int
+		expect        []string
+	}{
+		// a torrent file has its metadata at once: the files are
+		// selected before starting it
+		{"torrent", []int{2, 3}, 0, []string{"add paused=true", "files", "select [1 2]", "start"}},
+		// a magnet link must be started to fetch its metadata
+		{"magnet", []int{1}, 2, []string{"add paused=true", "files", "start", "files", "files", "select [0]"}},
+		{"all", nil, 0, []string{"add paused=false"}},
+	}
+	for _, test := range tests {
+		d := &fakeSelector{files: files, metadataAfter: test.metadataAfter}
+		res := &showResult{}
+		if !addPack(context.Background(), d, pack, test.wanted, cfg, res) || len(res.Errors) > 0 {
+			t.Errorf("%s: pack not added: %v", test.name, res.Errors)
+		}
+		if !reflect.DeepEqual(d.calls, test.expect) {
+			t.Errorf("%s: expected calls %v, got %v", test.name, test.expect, d.calls)
+		}
+	}
+
+	// clients unable to select files download the whole pack at once
+	d := &fakeDownloader{}
+	res := &showResult{}
+	if !addPack(context.Background(), d, pack, []int{1}, cfg, res) || len(d.added) != 1 || d.added[0].Paused {
+		t.Errorf("expected the pack to be added unpaused, got %+v", d.added)
+	}
+}
+
+// fakeProvider serves shows from a map of URLs to release names. The
+// shows in wait are only returned once a missing show was asked for.
+type fakeProvider struct {
+	shows   map[string][]string
+	wait    map[string]bool
+	release chan struct{}
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) ListShows(ctx context.Context) ([]eztv.Show, error) { return nil, nil }
+
+func (p *fakeProvider) GetShow(ctx context.Context, URL string) (eztv.Show, error) {
+	if p.wait[URL] {
+		<-p.release
+	}
+	titles, ok := p.shows[URL]
+	if !ok {
+		close(p.release)
+		return eztv.Show{}, errors.New("404 Not Found")
+	}
+	show := eztv.Show{URL: URL, Source: p.Name()}
+	for _, t := range titles {
+		e := &eztv.Episode{Title: t, MagnetURL: "magnet:?xt=urn:btih:" + t, Seeds: -1, Peers: -1}
+		e.SetRelease(release.Parse(t))
+		show.Episodes = append(show.Episodes, e)
+	}
+	return show, nil
+}
+
+func (p *fakeProvider) Latest(ctx context.Context, n int) ([]*eztv.Episode, error) { return nil, nil }
+
+func (p *fakeProvider) Search(ctx context.Context, q provider.Query) ([]*eztv.Episode, error) {
+	return nil, nil
+}
+
+func TestUpdateAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ezupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	selector, err := selection.New(selection.Policy{Qualities: []string{"1080p", "720p"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Data: DataCfg{DefaultPath: dir},
+		Shows: []ShowCfg{
+			{Title: "Slow", URL: "/shows/1/slow/"},
+			{Title: "Fast", URL: "/shows/2/fast/"},
+			{Title: "Gone", URL: "/shows/3/gone/"},
+		},
+		selector: selector,
+	}
+	// Slow is fetched last, once Gone failed, so that the shows are
+	// done out of order
+	p := &fakeProvider{
+		shows: map[string][]string{
+			"/shows/1/slow/": {"Slow.S01E01.720p.HDTV.x264-A", "Slow.S01E01.1080p.WEB.x264-B", "Slow.S01E02.720p.HDTV.x264-A"},
+			"/shows/2/fast/": {"Fast.S02E05.1080p.WEB.x264-B"},
+		},
+		wait:    map[string]bool{"/shows/1/slow/": true},
+		release: make(chan struct{}),
+	}
+	ps := provider.Set{p}
+	d := &fakeDownloader{}
+	var out bytes.Buffer
+	results := updateAll(context.Background(), &out, ps, d, cfg, 2)
+
+	expect := []struct {
+		title           string
+		fetched, queued int
+		failed          bool
+	}{
+		{"Slow", 3, 2, false},
+		{"Fast", 1, 1, false},
+		{"Gone", 0, 0, true},
+	}
+	if len(results) != len(expect) {
+		t.Fatalf("expected %d results, got %d", len(expect), len(results))
+	}
+	for i, e := range expect {
+		r := results[i]
+		if r.Title != e.title || r.Fetched != e.fetched || r.Queued != e.queued || (len(r.Errors) > 0) != e.failed {
+			t.Errorf("expected %s: %d releases, %d queued, failed %v; got %s: %d releases, %d queued, errors %v",
+				e.title, e.fetched, e.queued, e.failed, r.Title, r.Fetched, r.Queued, r.Errors)
+		}
+	}
+	if len(d.added) != 3 {
+		t.Errorf("expected 3 torrents added, got %+v", d.added)
+	}
+	// the output of each show is written once it is done
+	if i, j := strings.Index(out.String(), "Fast"), strings.Index(out.String(), "Slow"); i < 0 || j < 0 || i > j {
+		t.Errorf("expected the output of Fast before Slow, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if failed := printSummary(&out, results); failed != 1 {
+		t.Errorf("expected 1 failed show, got %d", failed)
+	}
+	for _, line := range []string{
+		"Updated 3 shows: 4 releases, 3 episodes queued, 1 shows failed\n",
+		"FAILED Gone: getting show Gone: fake: 404 Not Found\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in the summary, got:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package deluge is a client for the Deluge Web UI JSON-RPC API.
+package deluge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Client struct {
+	URL    string
+	pwd    string
+	client *http.Client
+	mu     sync.Mutex
+	id     int
+}
+
+// Torrent is the status of a torrent as returned by
+// core.get_torrents_status for the keys in TorrentKeys.
+type Torrent struct {
+	Hash         string  `json:"hash"`
+	Name         string  `json:"name"`
+	State        string  `json:"state"`
+	Progress     float64 `json:"progress"` // between 0 and 100
+	SavePath     string  `json:"save_path"`
+	TotalSize    int64   `json:"total_size"`
+	DownloadRate float64 `json:"download_payload_rate"`
+	UploadRate   float64 `json:"upload_payload_rate"`
+	NumPeers     int     `json:"num_peers"`
+	NumSeeds     int     `json:"num_seeds"`
+	Message      string  `json:"message"`
+	Label        string  `json:"label"`
+}
+
+// TorrentKeys are the status keys requested by Torrents.
+var TorrentKeys = []string{
+	"hash", "name", "state", "progress", "save_path", "total_size",
+	"download_payload_rate", "upload_payload_rate", "num_peers",
+	"num_seeds", "message", "label",
+}
+
+// AddOptions are the torrent options used by AddTorrent.
+type AddOptions struct {
+	DownloadLocation string `json:"download_location,omitempty"`
+	AddPaused        bool   `json:"add_paused"`
+}
+
+// Error is an error returned by the JSON-RPC server.
+type Error struct {
+	Method  string
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (code %d)", e.Method, e.Message, e.Code)
+}
+
+// DefaultHTTPClient is used when NewClient is given a nil *http.Client.
+var DefaultHTTPClient = &http.Client{Timeout: time.Minute}
+
+// NewClient logs in to the Deluge Web UI at URL and, if the Web UI is
+// not connected to a daemon yet, connects it to the first known host.
+// It uses a copy of hc, or of DefaultHTTPClient if hc is nil, with its
+// own cookie jar.
+func NewClient(ctx context.Context, hc *http.Client, URL, password string) (*Client, error) {
+	if hc == nil {
+		hc = DefaultHTTPClient
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *hc
+	client.Jar = jar
+	c := &Client{URL: strings.TrimRight(URL, "/"), pwd: password, client: &client}
+	if err := c.Login(ctx); err != nil {
+		return c, err
+	}
+	return c, c.connect(ctx)
+}
+
+// Login gets a new session cookie.
+func (c *Client) Login(ctx context.Context) error {
+	var ok bool
+	if err := c.Call(ctx, "auth.login", []interface{}{c.pwd}, &ok); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("unable to login to Deluge: wrong password")
+	}
+	return nil
+}
+
+// connect connects the Web UI to the first daemon, unless it is
+// already connected.
+func (c *Client) connect(ctx context.Context) error {
+	var connected bool
+	if err := c.call(ctx, "web.connected", nil, &connected); err != nil {
+		return err
+	}
+	if connected {
+		return nil
+	}
+	var hosts [][]interface{}
+	if err := c.call(ctx, "web.get_hosts", nil, &hosts); err != nil {
+		return err
+	}
+	if len(hosts) == 0 || len(hosts[0]) == 0 {
+		return fmt.Errorf("the Deluge Web UI knows no daemon to connect to")
+	}
+	return c.call(ctx, "web.connect", []interface{}{hosts[0][0]}, nil)
+}
+
+// codeNotAuthenticated is the code of the errors of calls made without a
+// valid session cookie.
+const codeNotAuthenticated = 1
+
+// Call runs the JSON-RPC method and decodes its result into result,
+// unless result is nil. When the session has expired, e.g. after a
+// restart of the Web UI, the client logs in again and retries once.
+func (c *Client) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	err := c.call(ctx, method, params, result)
+	if e, ok := err.(*Error); !ok || e.Code != codeNotAuthenticated || method == "auth.login" {
+		return err
+	}
+	if err := c.Login(ctx); err != nil {
+		return err
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+	return c.call(ctx, method, params, result)
+}
+
+func (c *Client) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	c.mu.Lock()
+	c.id++
+	id := c.id
+	c.mu.Unlock()
+
+	b, err := json.Marshal(map[string]interface{}{"method": method, "params": params, "id": id})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL+"/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("got error %d (%s) while calling %s", resp.StatusCode, resp.Status, method)
+	}
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("invalid reply to %s: %v", method, err)
+	}
+	if reply.Error != nil {
+		reply.Error.Method = method
+		return reply.Error
+	}
+	if result == nil || len(reply.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// AddTorrent adds a magnet link or a torrent URL and returns the hash of
+// the new torrent.
+func (c *Client) AddTorrent(ctx context.Context, uri string, opts AddOptions) (string, error) {
+	method := "core.add_torrent_url"
+	if strings.HasPrefix(uri, "magnet:") {
+		method = "core.add_torrent_magnet"
+	}
+	var hash *string
+	if err := c.Call(ctx, method, []interface{}{uri, opts}, &hash); err != nil {
+		return "", err
+	}
+	if hash == nil {
+		// Deluge returns null when the torrent is already there
+		return "", fmt.Errorf("unable to add torrent %s: already present or invalid", uri)
+	}
+	return *hash, nil
+}
+
+// Torrents returns the torrents with the given hashes, or all of them if
+// no hash is given.
+func (c *Client) Torrents(ctx context.Context, hashes ...string) ([]Torrent, error) {
+	filter := map[string]interface{}{}
+	if len(hashes) > 0 {
+		filter["id"] = hashes
+	}
+	var status map[string]Torrent
+	if err := c.Call(ctx, "core.get_torrents_status", []interface{}{filter, TorrentKeys}, &status); err != nil {
+		return nil, err
+	}
+	var torrents []Torrent
+	for hash, t := range status {
+		t.Hash = hash
+		torrents = append(torrents, t)
+	}
+	return torrents, nil
+}
+
+// Remove removes a torrent, and its data if removeData is true.
+func (c *Client) Remove(ctx context.Context, hash string, removeData bool) error {
+	return c.Call(ctx, "core.remove_torrent", []interface{}{hash, removeData}, nil)
+}
+
+// Move moves the data of the torrents to dest.
+func (c *Client) Move(ctx context.Context, dest string, hashes ...string) error {
+	return c.Call(ctx, "core.move_storage", []interface{}{hashes, dest}, nil)
+}
+
+// Pause pauses the torrents.
+func (c *Client) Pause(ctx context.Context, hashes ...string) error {
+	return c.Call(ctx, "core.pause_torrents", []interface{}{hashes}, nil)
+}
+
+// Resume resumes the torrents.
+func (c *Client) Resume(ctx context.Context, hashes ...string) error {
+	return c.Call(ctx, "core.resume_torrents", []interface{}{hashes}, nil)
+}
+
+// Reannounce asks the trackers for more peers.
+func (c *Client) Reannounce(ctx context.Context, hashes ...string) error {
+	return c.Call(ctx, "core.force_reannounce", []interface{}{hashes}, nil)
+}
+
+// Labels returns the labels known to the label plugin.
+func (c *Client) Labels(ctx context.Context) ([]string, error) {
+	var labels []string
+	err := c.Call(ctx, "label.get_labels", nil, &labels)
+	return labels, err
+}
+
+// SetLabel sets the label of a torrent, creating the label if needed.
+// The label plugin only accepts lowercase letters, digits, '_' and '-':
+// other characters are replaced by '_'.
+func (c *Client) SetLabel(ctx context.Context, hash, label string) error {
+	label = LabelName(label)
+	labels, err := c.Labels(ctx)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, l := range labels {
+		if l == label {
+			found = true
+			break
+		}
+	}
+	if !found {
+		if err := c.Call(ctx, "label.add", []interface{}{label}, nil); err != nil {
+			return err
+		}
+	}
+	return c.Call(ctx, "label.set_torrent", []interface{}{hash, label}, nil)
+}
+
+// LabelName converts s into a valid label name.
+func LabelName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,227 @@
+package deluge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type rpcRequest struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     int               `json:"id"`
+}
+
+// fake is a Deluge Web UI stand-in. Calls other than auth.login require
+// the session cookie, and the Web UI starts disconnected.
+type fake struct {
+	*httptest.Server
+	session   string
+	connected bool
+	labels    []string
+	calls     map[string][]json.RawMessage
+	status    map[string]Torrent
+}
+
+func fakeServer(t *testing.T) *fake {
+	f := &fake{session: "s1", calls: make(map[string][]json.RawMessage)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/json" {
+			http.NotFound(w, r)
+			return
+		}
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			return
+		}
+		f.calls[req.Method] = req.Params
+		reply := func(result interface{}, err interface{}) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": req.ID, "result": result, "error": err})
+		}
+		if req.Method == "auth.login" {
+			var pwd string
+			json.Unmarshal(req.Params[0], &pwd)
+			if pwd != "deluge" {
+				reply(false, nil)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: f.session, Path: "/"})
+			reply(true, nil)
+			return
+		}
+		if c, err := r.Cookie("_session_id"); err != nil || c.Value != f.session {
+			reply(nil, map[string]interface{}{"message": "Not authenticated", "code": 1})
+			return
+		}
+		switch req.Method {
+		case "web.connected":
+			reply(f.connected, nil)
+		case "web.get_hosts":
+			reply([][]interface{}{{"host1", "127.0.0.1", 58846, "Online"}}, nil)
+		case "web.connect":
+			f.connected = true
+			reply(nil, nil)
+		case "core.add_torrent_magnet", "core.add_torrent_url":
+			reply("abcd", nil)
+		case "core.get_torrents_status":
+			reply(f.status, nil)
+		case "label.get_labels":
+			reply(f.labels, nil)
+		case "label.add":
+			var l string
+			json.Unmarshal(req.Params[0], &l)
+			f.labels = append(f.labels, l)
+			reply(nil, nil)
+		case "label.set_torrent", "core.remove_torrent", "core.move_storage",
+			"core.pause_torrents", "core.resume_torrents", "core.force_reannounce":
+			reply(true, nil)
+		default:
+			reply(nil, map[string]interface{}{"message": "Unknown method", "code": 2})
+		}
+	}))
+	return f
+}
+
+func TestLoginAndConnect(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+
+	if _, err := NewClient(ctx, nil, srv.URL, "wrong"); err == nil {
+		t.Errorf("expected login error with a wrong password")
+	}
+	if _, err := NewClient(ctx, nil, srv.URL, "deluge"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.connected {
+		t.Errorf("expected the client to connect the Web UI")
+	}
+	var host string
+	json.Unmarshal(srv.calls["web.connect"][0], &host)
+	if host != "host1" {
+		t.Errorf("expected connection to host1, got %q", host)
+	}
+}
+
+func TestRelogin(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "deluge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the Web UI restarted: the session is gone and it is disconnected
+	srv.session, srv.connected = "s2", false
+	delete(srv.calls, "auth.login")
+	if _, err := c.Torrents(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.calls["auth.login"]; !ok || !srv.connected {
+		t.Errorf("expected the client to login and connect again")
+	}
+
+	// a wrong password is not retried forever
+	c.pwd = "wrong"
+	srv.session = "s3"
+	if _, err := c.Torrents(ctx); err == nil {
+		t.Errorf("expected login error")
+	}
+}
+
+func TestAddTorrent(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "deluge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := c.AddTorrent(ctx, "magnet:?xt=urn:btih:abcd", AddOptions{DownloadLocation: "/downloads/Show", AddPaused: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "abcd" {
+		t.Errorf("expected hash abcd, got %q", hash)
+	}
+	params := srv.calls["core.add_torrent_magnet"]
+	var opts AddOptions
+	if len(params) != 2 || json.Unmarshal(params[1], &opts) != nil {
+		t.Fatalf("unexpected params %s", params)
+	}
+	if opts.DownloadLocation != "/downloads/Show" || !opts.AddPaused {
+		t.Errorf("unexpected options %+v", opts)
+	}
+
+	if _, err := c.AddTorrent(ctx, "https://example.com/x.torrent", AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.calls["core.add_torrent_url"]; !ok {
+		t.Errorf("expected core.add_torrent_url for a torrent URL")
+	}
+}
+
+func TestTorrents(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+	srv.status = map[string]Torrent{"abcd": {Name: "Show.S01E01", State: "Downloading", Progress: 50}}
+	c, err := NewClient(ctx, nil, srv.URL, "deluge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrents, err := c.Torrents(ctx, "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 || torrents[0].Hash != "abcd" || torrents[0].Progress != 50 {
+		t.Errorf("unexpected torrents %+v", torrents)
+	}
+	var filter map[string][]string
+	json.Unmarshal(srv.calls["core.get_torrents_status"][0], &filter)
+	if len(filter["id"]) != 1 || filter["id"][0] != "abcd" {
+		t.Errorf("unexpected filter %v", filter)
+	}
+}
+
+func TestSetLabel(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "deluge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetLabel(ctx, "abcd", "tv/Mr Robot"); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.labels) != 1 || srv.labels[0] != "tv_mr_robot" {
+		t.Errorf("expected label tv_mr_robot to be created, got %v", srv.labels)
+	}
+	// An existing label is not created again
+	delete(srv.calls, "label.add")
+	if err := c.SetLabel(ctx, "ef01", "tv_mr_robot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.calls["label.add"]; ok {
+		t.Errorf("expected existing label not to be added again")
+	}
+}
+
+func TestError(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "deluge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Call(ctx, "core.no_such_method", nil, nil)
+	if e, ok := err.(*Error); !ok || e.Message != "Unknown method" {
+		t.Errorf("expected Unknown method error, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arcimboldo/tv/aria2"
+)
+
+type aria2Client struct {
+	c *aria2.Client
+}
+
+// newAria2 connects to the aria2 JSON-RPC endpoint. The password is the
+// --rpc-secret token. aria2 has no labels.
+func newAria2(ctx context.Context, cfg Config) (Downloader, error) {
+	c, err := aria2.NewClient(ctx, cfg.HTTPClient, cfg.URL, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &aria2Client{c}, nil
+}
+
+func aria2Torrent(s aria2.Status) Torrent {
+	t := Torrent{
+		ID:           s.Gid,
+		Name:         s.Name(),
+		Progress:     s.Progress(),
+		Dir:          s.Dir,
+		Size:         int64(s.TotalLength),
+		DownloadRate: int64(s.DownloadSpeed),
+		UploadRate:   int64(s.UploadSpeed),
+		Peers:        int(s.Connections),
+	}
+	switch s.Status {
+	case "active":
+		t.State = StateDownloading
+		if t.Done() {
+			t.State = StateSeeding
+		}
+	case "waiting":
+		t.State = StateQueued
+	case "paused":
+		t.State = StatePaused
+	case "error":
+		t.State = StateError
+		t.Error = s.ErrorMessage
+	case "complete":
+		t.State = StateSeeding
+		t.Progress = 1
+	default:
+		t.State = StateUnknown
+	}
+	return t
+}
+
+func (a *aria2Client) Add(ctx context.Context, opts AddOptions) (Torrent, error) {
+	gid, err := a.c.AddURI(ctx, opts.URL, opts.Dir, opts.Paused)
+	if err != nil {
+		return Torrent{}, err
+	}
+	return Torrent{ID: gid, Dir: opts.Dir, State: StateQueued}, nil
+}
+
+// status returns the status of a download. A magnet download only
+// fetches the metadata and is then followed by the actual download,
+// whose status is returned instead.
+func (a *aria2Client) status(ctx context.Context, gid string) (Torrent, error) {
+	s, err := a.c.TellStatus(ctx, gid)
+	if err != nil {
+		return Torrent{}, err
+	}
+	if len(s.FollowedBy) > 0 {
+		if next, err := a.c.TellStatus(ctx, s.FollowedBy[0]); err == nil {
+			s = next
+		}
+	}
+	return aria2Torrent(s), nil
+}
+
+func (a *aria2Client) Status(ctx context.Context, ids ...string) ([]Torrent, error) {
+	var torrents []Torrent
+	if len(ids) == 0 {
+		all, err := a.c.Downloads(ctx)
+		for _, s := range all {
+			if len(s.FollowedBy) == 0 {
+				torrents = append(torrents, aria2Torrent(s))
+			}
+		}
+		return torrents, err
+	}
+	for _, id := range ids {
+		t, err := a.status(ctx, id)
+		if err != nil {
+			return torrents, err
+		}
+		torrents = append(torrents, t)
+	}
+	return torrents, nil
+}
+
+// Remove removes the downloads. aria2 cannot delete the downloaded data,
+// which is left on disk even when deleteData is true.
+func (a *aria2Client) Remove(ctx context.Context, deleteData bool, ids ...string) error {
+	var errs []string
+	for _, id := range ids {
+		err := a.c.Remove(ctx, id)
+		if err != nil {
+			// stopped downloads can only be forgotten
+			err = a.c.RemoveResult(ctx, id)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to remove downloads: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (a *aria2Client) Move(ctx context.Context, dir string, ids ...string) error {
+	return fmt.Errorf("aria2 cannot move downloads")
+}
+
+func (a *aria2Client) Start(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		if err := a.c.Unpause(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *aria2Client) Stop(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		if err := a.c.Pause(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/arcimboldo/tv/blackhole"
+	"github.com/arcimboldo/tv/magnet"
+)
+
+type blackholeClient struct {
+	dir    string
+	client *http.Client
+}
+
+// newBlackhole returns a client writing torrents into the watch
+// directory cfg.Dir. The ids of the torrents are the paths of the files.
+func newBlackhole(ctx context.Context, cfg Config) (Downloader, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("blackhole client requires a watch directory")
+	}
+	return &blackholeClient{cfg.Dir, cfg.HTTPClient}, nil
+}
+
+// Add writes the torrent into opts.WatchDir, or the configured watch
+// directory. The download directory and the labels are up to the client
+// watching the directory.
+func (b *blackholeClient) Add(ctx context.Context, opts AddOptions) (Torrent, error) {
+	dir := b.dir
+	if opts.WatchDir != "" {
+		dir = opts.WatchDir
+	}
+	name := opts.Name
+	if name == "" {
+		name = magnet.Hash(opts.URL)
+	}
+	path, err := blackhole.Add(ctx, b.client, dir, name, opts.URL)
+	if err != nil {
+		return Torrent{ID: path, Name: name}, err
+	}
+	return Torrent{ID: path, Name: name, State: StateQueued}, nil
+}
+
+func (b *blackholeClient) Status(ctx context.Context, ids ...string) ([]Torrent, error) {
+	if len(ids) == 0 {
+		var err error
+		if ids, err = blackhole.List(b.dir); err != nil {
+			return nil, err
+		}
+	}
+	var torrents []Torrent
+	for _, id := range ids {
+		t := Torrent{ID: id, Name: strings.TrimSuffix(filepath.Base(id), filepath.Ext(id)), Dir: filepath.Dir(id)}
+		switch blackhole.Stat(id) {
+		case blackhole.Pending:
+			t.State = StateQueued
+		default:
+			// loaded by the client, which alone knows its progress
+			t.State = StateUnknown
+		}
+		torrents = append(torrents, t)
+	}
+	return torrents, nil
+}
+
+// Remove deletes the files not yet loaded by the client. Torrents
+// already loaded must be removed from the client itself.
+func (b *blackholeClient) Remove(ctx context.Context, deleteData bool, ids ...string) error {
+	for _, id := range ids {
+		if err := blackhole.Remove(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *blackholeClient) Move(ctx context.Context, dir string, ids ...string) error {
+	return fmt.Errorf("blackhole cannot move downloads")
+}
@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arcimboldo/tv/deluge"
+	"github.com/arcimboldo/tv/magnet"
+)
+
+type delugeClient struct {
+	c *deluge.Client
+}
+
+// newDeluge connects to the Deluge Web UI. The Web UI has no user, only
+// a password.
+func newDeluge(ctx context.Context, cfg Config) (Downloader, error) {
+	c, err := deluge.NewClient(ctx, cfg.HTTPClient, cfg.URL, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &delugeClient{c}, nil
+}
+
+func delugeTorrent(info deluge.Torrent) Torrent {
+	t := Torrent{
+		ID:           info.Hash,
+		Name:         info.Name,
+		Progress:     info.Progress / 100,
+		Dir:          info.SavePath,
+		Size:         info.TotalSize,
+		DownloadRate: int64(info.DownloadRate),
+		UploadRate:   int64(info.UploadRate),
+		Peers:        info.NumPeers + info.NumSeeds,
+	}
+	if info.Label != "" {
+		t.Labels = []string{info.Label}
+	}
+	switch info.State {
+	case "Error":
+		t.State = StateError
+		t.Error = info.Message
+	case "Seeding":
+		t.State = StateSeeding
+	case "Queued":
+		t.State = StateQueued
+	case "Paused":
+		t.State = StatePaused
+	case "Checking", "Allocating":
+		t.State = StateChecking
+	case "Downloading", "Moving":
+		t.State = StateDownloading
+	default:
+		t.State = StateUnknown
+	}
+	return t
+}
+
+// Add adds the torrent and sets the label plugin label to the first of
+// the labels. Labels are not supported by the daemon without the
+// plugin: failing to set them is not an error.
+func (d *delugeClient) Add(ctx context.Context, opts AddOptions) (Torrent, error) {
+	if hash := magnet.Hash(opts.URL); hash != "" {
+		if existing, err := d.c.Torrents(ctx, hash); err == nil && len(existing) > 0 {
+			return delugeTorrent(existing[0]), fmt.Errorf("duplicated torrent with id %s", hash)
+		}
+	}
+	hash, err := d.c.AddTorrent(ctx, opts.URL, deluge.AddOptions{DownloadLocation: opts.Dir, AddPaused: opts.Paused})
+	if err != nil {
+		return Torrent{}, err
+	}
+	if len(opts.Labels) > 0 {
+		d.c.SetLabel(ctx, hash, opts.Labels[0])
+	}
+	return Torrent{ID: hash, Dir: opts.Dir, State: StateQueued}, nil
+}
+
+func (d *delugeClient) Status(ctx context.Context, ids ...string) ([]Torrent, error) {
+	infos, err := d.c.Torrents(ctx, ids...)
+	var torrents []Torrent
+	for _, info := range infos {
+		torrents = append(torrents, delugeTorrent(info))
+	}
+	return torrents, err
+}
+
+func (d *delugeClient) Remove(ctx context.Context, deleteData bool, ids ...string) error {
+	var errs []string
+	for _, id := range ids {
+		if err := d.c.Remove(ctx, id, deleteData); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to remove torrents: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (d *delugeClient) Move(ctx context.Context, dir string, ids ...string) error {
+	return d.c.Move(ctx, dir, ids...)
+}
+
+func (d *delugeClient) Start(ctx context.Context, ids ...string) error {
+	return d.c.Resume(ctx, ids...)
+}
+
+func (d *delugeClient) Stop(ctx context.Context, ids ...string) error {
+	return d.c.Pause(ctx, ids...)
+}
+
+func (d *delugeClient) Reannounce(ctx context.Context, ids ...string) error {
+	return d.c.Reannounce(ctx, ids...)
+}
@@ -0,0 +1,163 @@
+// Package downloader defines the interface ezupdate uses to drive a
+// torrent client, and adapts the supported clients to it.
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/arcimboldo/tv/deluge"
+)
+
+// State is the activity of a torrent, common to all the clients.
+type State string
+
+const (
+	StateQueued      State = "queued"
+	StateChecking    State = "checking"
+	StateDownloading State = "downloading"
+	StateSeeding     State = "seeding"
+	StatePaused      State = "paused"
+	StateError       State = "error"
+	StateUnknown     State = "unknown"
+)
+
+// Torrent is a torrent known to a client.
+type Torrent struct {
+	// ID identifies the torrent for the client. For most clients it
+	// is the info hash.
+	ID           string
+	Name         string
+	State        State
+	Progress     float64 // between 0 and 1
+	Dir          string  // download directory, as seen by the client
+	Error        string
+	Size         int64
+	DownloadRate int64 // bytes per second
+	UploadRate   int64
+	Peers        int
+	// Labels are the labels, tags or ruTorrent label of the torrent,
+	// as stored by the client
+	Labels []string
+}
+
+// Done returns true when all the wanted data has been downloaded.
+func (t Torrent) Done() bool {
+	return t.Progress >= 1
+}
+
+// HasLabel returns true if one of the labels of the torrent was set by
+// adding it with a label "<prefix>/<something>". Deluge stores them as
+// "<prefix>_<something>", lowercase.
+func (t Torrent) HasLabel(prefix string) bool {
+	for _, l := range t.Labels {
+		if strings.HasPrefix(l, prefix+"/") || strings.HasPrefix(l, deluge.LabelName(prefix+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddOptions describes a torrent to add.
+type AddOptions struct {
+	URL    string // magnet or torrent URL
+	Dir    string // download directory, as seen by the client
+	Labels []string
+	Paused bool
+	// Name is used by clients that need a name before knowing the
+	// torrent, e.g. the file name for blackhole.
+	Name string
+	// WatchDir overrides the watch directory of blackhole.
+	WatchDir string
+}
+
+// Downloader is a torrent client.
+type Downloader interface {
+	// Add adds a torrent. If the client already has it, the existing
+	// torrent is returned together with an error.
+	Add(ctx context.Context, opts AddOptions) (Torrent, error)
+	// Status returns the torrents with the given ids, or all of them
+	// if no id is given.
+	Status(ctx context.Context, ids ...string) ([]Torrent, error)
+	// Remove removes the torrents, and their data if deleteData is true.
+	Remove(ctx context.Context, deleteData bool, ids ...string) error
+	// Move moves the data of the torrents to dir.
+	Move(ctx context.Context, dir string, ids ...string) error
+}
+
+// Starter is implemented by clients able to start and stop torrents.
+type Starter interface {
+	Start(ctx context.Context, ids ...string) error
+	Stop(ctx context.Context, ids ...string) error
+}
+
+// Reannouncer is implemented by clients able to ask the trackers for
+// more peers on demand.
+type Reannouncer interface {
+	Reannounce(ctx context.Context, ids ...string) error
+}
+
+// File is a file of a torrent.
+type File struct {
+	Name   string // path in the torrent
+	Size   int64
+	Wanted bool
+}
+
+// FileSelector is implemented by clients able to download only some of
+// the files of a torrent.
+type FileSelector interface {
+	// Files returns the files of the torrent, none until the client has
+	// its metadata, e.g. while fetching it for a magnet link.
+	Files(ctx context.Context, id string) ([]File, error)
+	// SelectFiles downloads only the files whose indexes in the list
+	// returned by Files are in wanted.
+	SelectFiles(ctx context.Context, id string, wanted []int) error
+}
+
+// Config selects and configures a client.
+type Config struct {
+	Type     string `yaml:"type"`
+	URL      string `yaml:"url,omitempty"`
+	User     string `yaml:"user,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// Label is the prefix of the labels set on the torrents. Each
+	// torrent is labelled <label>/<show title>.
+	Label string `yaml:"label,omitempty"`
+	// Dir is the watch directory of blackhole.
+	Dir string `yaml:"dir,omitempty"`
+	// HTTPClient is used for all the requests to the client. If nil
+	// each client package uses its default.
+	HTTPClient *http.Client `yaml:"-"`
+}
+
+var clients = map[string]func(context.Context, Config) (Downloader, error){
+	"transmission": newTransmission,
+	"qbittorrent":  newQbittorrent,
+	"deluge":       newDeluge,
+	"aria2":        newAria2,
+	"blackhole":    newBlackhole,
+	"rtorrent":     newRtorrent,
+}
+
+// New connects to the client selected by cfg.Type.
+func New(ctx context.Context, cfg Config) (Downloader, error) {
+	newClient, ok := clients[strings.ToLower(cfg.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unknown client type %q, must be one of %v", cfg.Type, Types())
+	}
+	return newClient(ctx, cfg)
+}
+
+// Types returns the names of the supported clients.
+func Types() []string {
+	var types []string
+	for t := range clients {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/arcimboldo/tv/deluge"
+	"github.com/arcimboldo/tv/qbittorrent"
+	"github.com/arcimboldo/tv/transmission"
+)
+
+func TestNewUnknownType(t *testing.T) {
+	if _, err := New(context.Background(), Config{Type: "nosuchclient"}); err == nil {
+		t.Errorf("expected error for unknown client type")
+	}
+}
+
+func TestHasLabel(t *testing.T) {
+	tests := []struct {
+		tr     Torrent
+		expect bool
+	}{
+		{trTorrent(transmission.TrInfo{Labels: []string{"tv/Show"}}), true},
+		{qbTorrent(qbittorrent.Torrent{Tags: "other, tv/Show"}), true},
+		{delugeTorrent(deluge.Torrent{Label: "tv_show"}), true},
+		{trTorrent(transmission.TrInfo{Labels: []string{"tv2/Show"}}), false},
+		{qbTorrent(qbittorrent.Torrent{}), false},
+		{delugeTorrent(deluge.Torrent{Label: "tvshow"}), false},
+	}
+	for _, test := range tests {
+		if got := test.tr.HasLabel("tv"); got != test.expect {
+			t.Errorf("labels %q: expected %v, got %v", test.tr.Labels, test.expect, got)
+		}
+	}
+}
+
+func TestTransmissionState(t *testing.T) {
+	tests := []struct {
+		info   transmission.TrInfo
+		expect State
+	}{
+		{transmission.TrInfo{Status: transmission.StatusStopped}, StatePaused},
+		{transmission.TrInfo{Status: transmission.StatusCheck}, StateChecking},
+		{transmission.TrInfo{Status: transmission.StatusDownloadWait}, StateQueued},
+		{transmission.TrInfo{Status: transmission.StatusDownload}, StateDownloading},
+		{transmission.TrInfo{Status: transmission.StatusSeed}, StateSeeding},
+		{transmission.TrInfo{Status: transmission.StatusStopped, Error: 3}, StateError},
+		{transmission.TrInfo{Status: transmission.StatusDownload, Error: 1}, StateDownloading},
+		{transmission.TrInfo{Status: transmission.StatusSeed, Error: 2}, StateSeeding},
+	}
+	for _, test := range tests {
+		if got := trTorrent(test.info).State; got != test.expect {
+			t.Errorf("status %v error %d: expected %s, got %s", test.info.Status, test.info.Error, test.expect, got)
+		}
+	}
+}
+
+func TestTransmissionSelectFiles(t *testing.T) {
+	var set map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Transmission-Session-Id", "sid")
+		if r.Method == "GET" {
+			return
+		}
+		var req struct {
+			Method    string                 `json:"method"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var args interface{}
+		switch req.Method {
+		case "torrent-get":
+			var files []map[string]interface{}
+			var stats []map[string]interface{}
+			for _, name := range []string{"Show.S03/Show.S03E01.mkv", "Show.S03/Show.S03E02.mkv", "Show.S03/Show.S03E03.mkv"} {
+				files = append(files, map[string]interface{}{"name": name, "length": 100})
+				stats = append(stats, map[string]interface{}{"wanted": true})
+			}
+			args = map[string]interface{}{"torrents": []map[string]interface{}{{"hashString": "abcd", "files": files, "fileStats": stats}}}
+		case "torrent-set":
+			set = req.Arguments
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": "success", "arguments": args})
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	d, err := New(ctx, Config{Type: "transmission", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, ok := d.(FileSelector)
+	if !ok {
+		t.Fatal("expected transmission to select files")
+	}
+	files, err := fs.Files(ctx, "abcd")
+	if err != nil || len(files) != 3 || files[1].Name != "Show.S03/Show.S03E02.mkv" || !files[1].Wanted {
+		t.Fatalf("unexpected files %+v (%v)", files, err)
+	}
+	if err := fs.SelectFiles(ctx, "abcd", []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(set["files-wanted"], []interface{}{float64(1)}) || !reflect.DeepEqual(set["files-unwanted"], []interface{}{float64(0), float64(2)}) {
+		t.Errorf("unexpected torrent-set arguments %v", set)
+	}
+}
@@ -0,0 +1,114 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arcimboldo/tv/magnet"
+	"github.com/arcimboldo/tv/qbittorrent"
+)
+
+type qbittorrentClient struct {
+	c        *qbittorrent.Client
+	category string
+}
+
+// newQbittorrent connects to qBittorrent. Torrents are added in the
+// category named after the configured label, and tagged with their
+// labels.
+func newQbittorrent(ctx context.Context, cfg Config) (Downloader, error) {
+	c, err := qbittorrent.NewClient(ctx, cfg.HTTPClient, cfg.URL, cfg.User, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &qbittorrentClient{c, cfg.Label}, nil
+}
+
+func qbTorrent(info qbittorrent.Torrent) Torrent {
+	t := Torrent{
+		ID:           info.Hash,
+		Name:         info.Name,
+		Progress:     info.Progress,
+		Dir:          info.SavePath,
+		Size:         info.Size,
+		DownloadRate: info.DlSpeed,
+		UploadRate:   info.UpSpeed,
+		Peers:        info.NumSeeds + info.NumLeech,
+	}
+	// tags are separated by ", "
+	for _, tag := range strings.Split(info.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			t.Labels = append(t.Labels, tag)
+		}
+	}
+	switch info.State {
+	case "error", "missingFiles":
+		t.State = StateError
+		t.Error = info.State
+	case "uploading", "stalledUP", "forcedUP":
+		t.State = StateSeeding
+	case "queuedUP", "queuedDL":
+		t.State = StateQueued
+	case "pausedUP", "pausedDL", "stoppedUP", "stoppedDL":
+		t.State = StatePaused
+	case "checkingUP", "checkingDL", "checkingResumeData", "allocating":
+		t.State = StateChecking
+	case "downloading", "stalledDL", "metaDL", "forcedDL", "forcedMetaDL", "moving":
+		t.State = StateDownloading
+	default:
+		t.State = StateUnknown
+	}
+	return t
+}
+
+// Add adds the torrent. qBittorrent does not return the hash of the new
+// torrent, so the returned ID is only set for magnet links.
+func (q *qbittorrentClient) Add(ctx context.Context, opts AddOptions) (Torrent, error) {
+	hash := magnet.Hash(opts.URL)
+	if hash != "" {
+		if existing, err := q.c.Torrents(ctx, "", hash); err == nil && len(existing) > 0 {
+			return qbTorrent(existing[0]), fmt.Errorf("duplicated torrent with id %s", hash)
+		}
+	}
+	err := q.c.AddTorrent(ctx, qbittorrent.AddOptions{
+		URLs:     []string{opts.URL},
+		SavePath: opts.Dir,
+		Category: q.category,
+		Tags:     opts.Labels,
+		Paused:   opts.Paused,
+	})
+	if err != nil {
+		return Torrent{}, err
+	}
+	return Torrent{ID: hash, Dir: opts.Dir, State: StateQueued}, nil
+}
+
+func (q *qbittorrentClient) Status(ctx context.Context, ids ...string) ([]Torrent, error) {
+	infos, err := q.c.Torrents(ctx, "", ids...)
+	var torrents []Torrent
+	for _, info := range infos {
+		torrents = append(torrents, qbTorrent(info))
+	}
+	return torrents, err
+}
+
+func (q *qbittorrentClient) Remove(ctx context.Context, deleteData bool, ids ...string) error {
+	return q.c.Delete(ctx, deleteData, ids...)
+}
+
+func (q *qbittorrentClient) Move(ctx context.Context, dir string, ids ...string) error {
+	return q.c.SetLocation(ctx, dir, ids...)
+}
+
+func (q *qbittorrentClient) Start(ctx context.Context, ids ...string) error {
+	return q.c.Resume(ctx, ids...)
+}
+
+func (q *qbittorrentClient) Stop(ctx context.Context, ids ...string) error {
+	return q.c.Pause(ctx, ids...)
+}
+
+func (q *qbittorrentClient) Reannounce(ctx context.Context, ids ...string) error {
+	return q.c.Reannounce(ctx, ids...)
+}
@@ -0,0 +1,108 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arcimboldo/tv/magnet"
+	"github.com/arcimboldo/tv/rtorrent"
+)
+
+type rtorrentClient struct {
+	c *rtorrent.Client
+}
+
+// newRtorrent connects to the rTorrent XML-RPC endpoint. Torrents are
+// labelled, using the ruTorrent label, with the first of their labels.
+func newRtorrent(ctx context.Context, cfg Config) (Downloader, error) {
+	c, err := rtorrent.NewClient(ctx, cfg.HTTPClient, cfg.URL, cfg.User, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &rtorrentClient{c}, nil
+}
+
+func rtTorrent(info rtorrent.Torrent) Torrent {
+	t := Torrent{
+		ID:           strings.ToLower(info.Hash),
+		Name:         info.Name,
+		Dir:          info.Directory,
+		Size:         info.SizeBytes,
+		DownloadRate: info.DownRate,
+		UploadRate:   info.UpRate,
+		Peers:        int(info.Peers),
+		Error:        info.Message,
+	}
+	if info.Label != "" {
+		t.Labels = []string{info.Label}
+	}
+	if info.SizeBytes > 0 {
+		t.Progress = float64(info.CompletedBytes) / float64(info.SizeBytes)
+	}
+	switch {
+	case info.Hashing:
+		t.State = StateChecking
+	case !info.Started || !info.Active:
+		t.State = StatePaused
+	case info.Complete:
+		t.State = StateSeeding
+	default:
+		t.State = StateDownloading
+	}
+	// rTorrent reports tracker warnings in d.message too: only a
+	// stopped torrent is in error
+	if info.Message != "" && !info.Started {
+		t.State = StateError
+	}
+	return t
+}
+
+// Add loads the torrent. The ID is only known for magnet links.
+func (r *rtorrentClient) Add(ctx context.Context, opts AddOptions) (Torrent, error) {
+	hash := magnet.Hash(opts.URL)
+	if hash != "" {
+		if existing, err := r.c.Torrents(ctx, hash); err == nil && len(existing) > 0 {
+			return rtTorrent(existing[0]), fmt.Errorf("duplicated torrent with id %s", hash)
+		}
+	}
+	ropts := rtorrent.AddOptions{Directory: opts.Dir, Paused: opts.Paused}
+	if len(opts.Labels) > 0 {
+		ropts.Label = opts.Labels[0]
+	}
+	if err := r.c.AddTorrent(ctx, opts.URL, ropts); err != nil {
+		return Torrent{}, err
+	}
+	return Torrent{ID: hash, Dir: opts.Dir, State: StateQueued}, nil
+}
+
+func (r *rtorrentClient) Status(ctx context.Context, ids ...string) ([]Torrent, error) {
+	infos, err := r.c.Torrents(ctx, ids...)
+	var torrents []Torrent
+	for _, info := range infos {
+		torrents = append(torrents, rtTorrent(info))
+	}
+	return torrents, err
+}
+
+// Remove erases the torrents. rTorrent cannot delete the downloaded
+// data, which is left on disk even when deleteData is true.
+func (r *rtorrentClient) Remove(ctx context.Context, deleteData bool, ids ...string) error {
+	return r.c.Erase(ctx, ids...)
+}
+
+func (r *rtorrentClient) Move(ctx context.Context, dir string, ids ...string) error {
+	return fmt.Errorf("rtorrent cannot move downloads")
+}
+
+func (r *rtorrentClient) Start(ctx context.Context, ids ...string) error {
+	return r.c.Start(ctx, ids...)
+}
+
+func (r *rtorrentClient) Stop(ctx context.Context, ids ...string) error {
+	return r.c.Stop(ctx, ids...)
+}
+
+func (r *rtorrentClient) Reannounce(ctx context.Context, ids ...string) error {
+	return r.c.Announce(ctx, ids...)
+}
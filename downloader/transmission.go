@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"context"
+
+	"github.com/arcimboldo/tv/transmission"
+)
+
+type transmissionClient struct {
+	t *transmission.Transmission
+}
+
+func newTransmission(ctx context.Context, cfg Config) (Downloader, error) {
+	t, err := transmission.NewClient(ctx, cfg.HTTPClient, cfg.URL, cfg.User, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &transmissionClient{t}, nil
+}
+
+// trIds converts ids to the form expected by the transmission package.
+// Torrents are identified by their hash string.
+func trIds(ids []string) []interface{} {
+	var tids []interface{}
+	for _, id := range ids {
+		tids = append(tids, id)
+	}
+	return tids
+}
+
+func trTorrent(info transmission.TrInfo) Torrent {
+	t := Torrent{
+		ID:           info.HashString,
+		Name:         info.Name,
+		Progress:     info.PercentDone,
+		Dir:          info.DownloadDir,
+		Error:        info.ErrorString,
+		Size:         info.TotalSize,
+		DownloadRate: int64(info.RateDownload),
+		UploadRate:   int64(info.RateUpload),
+		Peers:        len(info.Peers),
+		Labels:       info.Labels,
+	}
+	switch info.Status {
+	case transmission.StatusStopped:
+		t.State = StatePaused
+	case transmission.StatusCheckWait, transmission.StatusCheck:
+		t.State = StateChecking
+	case transmission.StatusDownloadWait, transmission.StatusSeedWait:
+		t.State = StateQueued
+	case transmission.StatusDownload:
+		t.State = StateDownloading
+	case transmission.StatusSeed:
+		t.State = StateSeeding
+	default:
+		t.State = StateUnknown
+	}
+	// Error is also set for tracker warnings and errors, on torrents
+	// that are downloading fine: only stopped torrents have failed.
+	if info.Error != 0 && info.Status == transmission.StatusStopped {
+		t.State = StateError
+	}
+	return t
+}
+
+func (c *transmissionClient) Add(ctx context.Context, opts AddOptions) (Torrent, error) {
+	var paused *bool
+	if opts.Paused {
+		paused = &opts.Paused
+	}
+	info, err := c.t.AddTorrentWith(ctx, transmission.AddOptions{
+		Filename:    opts.URL,
+		DownloadDir: opts.Dir,
+		Labels:      opts.Labels,
+		Paused:      paused,
+	})
+	return trTorrent(info), err
+}
+
+func (c *transmissionClient) Status(ctx context.Context, ids ...string) ([]Torrent, error) {
+	infos, err := c.t.GetTorrents(ctx, trIds(ids)...)
+	var torrents []Torrent
+	for _, info := range infos {
+		torrents = append(torrents, trTorrent(info))
+	}
+	return torrents, err
+}
+
+func (c *transmissionClient) Remove(ctx context.Context, deleteData bool, ids ...string) error {
+	return c.t.RemoveTorrents(ctx, deleteData, trIds(ids)...)
+}
+
+func (c *transmissionClient) Move(ctx context.Context, dir string, ids ...string) error {
+	return c.t.SetLocation(ctx, dir, true, trIds(ids)...)
+}
+
+func (c *transmissionClient) Start(ctx context.Context, ids ...string) error {
+	return c.t.StartTorrents(ctx, trIds(ids)...)
+}
+
+func (c *transmissionClient) Stop(ctx context.Context, ids ...string) error {
+	return c.t.StopTorrents(ctx, trIds(ids)...)
+}
+
+func (c *transmissionClient) Reannounce(ctx context.Context, ids ...string) error {
+	return c.t.ReannounceTorrents(ctx, trIds(ids)...)
+}
+
+func (c *transmissionClient) Files(ctx context.Context, id string) ([]File, error) {
+	info, err := c.t.GetTorrent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	for i, f := range info.Files {
+		files = append(files, File{Name: f.Name, Size: f.Length, Wanted: i >= len(info.FileStats) || info.FileStats[i].Wanted})
+	}
+	return files, nil
+}
+
+func (c *transmissionClient) SelectFiles(ctx context.Context, id string, wanted []int) error {
+	files, err := c.Files(ctx, id)
+	if err != nil {
+		return err
+	}
+	want := make(map[int]bool)
+	for _, i := range wanted {
+		want[i] = true
+	}
+	var unwanted []int
+	for i := range files {
+		if !want[i] {
+			unwanted = append(unwanted, i)
+		}
+	}
+	return c.t.SetFiles(ctx, wanted, unwanted, id)
+}
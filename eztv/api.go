@@ -0,0 +1,212 @@
+package eztv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// apiPage is a page of the get-torrents API.
+type apiPage struct {
+	ImdbID        string    `json:"imdb_id"`
+	TorrentsCount int       `json:"torrents_count"`
+	Limit         int       `json:"limit"`
+	Page          int       `json:"page"`
+	Torrents      []RSSShow `json:"torrents"`
+}
+
+// getTorrents fetches page p of the get-torrents API, with n torrents
+// per page. If imdbID is not empty only the torrents of that show are
+// returned.
+func (c *Client) getTorrents(ctx context.Context, imdbID string, n, p int) (apiPage, error) {
+	path := fmt.Sprintf("/api/get-torrents?limit=%d&page=%d", n, p)
+	if imdbID != "" {
+		path += "&imdb_id=" + imdbID
+	}
+	var page apiPage
+	body, _, err := c.get(ctx, path)
+	if err != nil {
+		return page, err
+	}
+	err = json.Unmarshal(body, &page)
+	return page, err
+}
+
+// NormImdbID returns the numeric part of an IMDb id, which is what the
+// API expects: "tt4158110" becomes "4158110". Ids are equal when their
+// numeric parts are.
+func NormImdbID(id string) string {
+	return strings.TrimLeft(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(id)), "tt"), "0")
+}
+
+// GetShowByImdbID gets a show and its episodes from the get-torrents API,
+// using DefaultClient
+func GetShowByImdbID(ctx context.Context, imdbID string) (Show, error) {
+	return DefaultClient.GetShowByImdbID(ctx, imdbID)
+}
+
+// GetShowByImdbID gets a show and its episodes from the get-torrents
+// API, filtered by IMDb id. Unlike GetShow it does not depend on the
+// layout of the show page, and episodes have seeds, peers, hashes, exact
+// sizes and release times. The title of the show is taken from the
+// releases and URL is left empty.
+func (c *Client) GetShowByImdbID(ctx context.Context, imdbID string) (Show, error) {
+	id := NormImdbID(imdbID)
+	show := Show{ImdbID: "tt" + id}
+	if id == "" {
+		return show, fmt.Errorf("invalid IMDb id %q", imdbID)
+	}
+	titles := make(map[string]int)
+	it := c.Releases(ctx, ReleaseOptions{ImdbID: id})
+	for it.Next() {
+		r := it.Release()
+		// the API ignores unknown ids and returns the latest torrents
+		if NormImdbID(r.ImdbID) != id {
+			break
+		}
+		e := r.AsEpisode()
+		if title, s, _ := ParseTitle(r.Title); s >= 0 {
+			titles[title]++
+		}
+		show.Episodes = append(show.Episodes, &e)
+	}
+	if err := it.Err(); err != nil {
+		return show, err
+	}
+	if len(show.Episodes) == 0 {
+		return show, fmt.Errorf("no torrents for IMDb id %s", show.ImdbID)
+	}
+
+	// the most common title wins, as some releases are named differently
+	best := 0
+	for title, n := range titles {
+		if n > best || (n == best && title < show.Title) {
+			show.Title, best = title, n
+		}
+	}
+	for _, e := range show.Episodes {
+		e.ShowTitle = show.Title
+	}
+	show.SortEpisodes()
+	return show, nil
+}
+
+// ReleaseOptions selects the releases returned by Client.Releases.
+type ReleaseOptions struct {
+	// ImdbID restricts the releases to a show
+	ImdbID string
+	// Since stops the iteration at the first release older than it
+	Since time.Time
+	// PageSize is the number of releases fetched per request, at most
+	// and by default 100
+	PageSize int
+	// MaxPages stops the iteration after fetching that many pages, 0
+	// means no limit
+	MaxPages int
+}
+
+// Releases is an iterator over the releases of the get-torrents API,
+// newest first. Pages are fetched lazily by Next, so callers can stop
+// at any time without fetching more than needed. Releases are returned
+// once even if they move to the next page while iterating.
+//
+//	it := c.Releases(ctx, eztv.ReleaseOptions{Since: yesterday})
+//	for it.Next() {
+//		r := it.Release()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Releases struct {
+	c    *Client
+	ctx  context.Context
+	opts ReleaseOptions
+
+	page    int
+	buf     []RSSShow
+	last    bool
+	cur     RSSShow
+	seen    map[string]bool
+	stopped bool
+	err     error
+}
+
+// Releases returns an iterator over the releases selected by opts.
+func (c *Client) Releases(ctx context.Context, opts ReleaseOptions) *Releases {
+	if opts.PageSize <= 0 || opts.PageSize > maxPageSize {
+		opts.PageSize = maxPageSize
+	}
+	opts.ImdbID = NormImdbID(opts.ImdbID)
+	return &Releases{c: c, ctx: ctx, opts: opts, seen: make(map[string]bool)}
+}
+
+// LatestReleases returns an iterator over the releases of DefaultClient.
+func LatestReleases(ctx context.Context, opts ReleaseOptions) *Releases {
+	return DefaultClient.Releases(ctx, opts)
+}
+
+// fetch gets the next page into the buffer. It returns false at the end
+// of the releases or on errors.
+func (it *Releases) fetch() bool {
+	if it.last || (it.opts.MaxPages > 0 && it.page >= it.opts.MaxPages) {
+		return false
+	}
+	page, err := it.c.getTorrents(it.ctx, it.opts.ImdbID, it.opts.PageSize, it.page+1)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.page++
+	it.buf = page.Torrents
+	// the count is not always given: a short page ends the releases too
+	if len(page.Torrents) < it.opts.PageSize || (page.TorrentsCount > 0 && it.page*it.opts.PageSize >= page.TorrentsCount) {
+		it.last = true
+	}
+	return len(it.buf) > 0
+}
+
+// Next advances to the next release, which is then returned by Release.
+// It returns false when there are no more releases, the Since cutoff is
+// reached or an error occurred.
+func (it *Releases) Next() bool {
+	for !it.stopped && it.err == nil {
+		if len(it.buf) == 0 && !it.fetch() {
+			break
+		}
+		r := it.buf[0]
+		it.buf = it.buf[1:]
+		if !it.opts.Since.IsZero() && r.Released.Before(it.opts.Since) {
+			break
+		}
+		key := strings.ToLower(r.Hash)
+		if key == "" {
+			key = fmt.Sprintf("id:%d", r.ID)
+		}
+		if it.seen[key] {
+			continue
+		}
+		it.seen[key] = true
+		it.cur = r
+		return true
+	}
+	it.stopped = true
+	return false
+}
+
+// Release returns the current release.
+func (it *Releases) Release() RSSShow {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Releases) Err() error {
+	return it.err
+}
+
+// Pages returns the number of pages fetched so far.
+func (it *Releases) Pages() int {
+	return it.page
+}
@@ -0,0 +1,208 @@
+package eztv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeAPI serves get-torrents from torrents, newest first, like eztv,
+// and counts the requests. Unknown IMDb ids return the latest torrents
+// of any show.
+func fakeAPI(t *testing.T, torrents *[]map[string]interface{}, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/get-torrents" {
+			http.NotFound(w, r)
+			return
+		}
+		*requests++
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		page, _ := strconv.Atoi(q.Get("page"))
+		if limit <= 0 || limit > 100 {
+			limit = 30
+		}
+		if page <= 0 {
+			page = 1
+		}
+		var selected []map[string]interface{}
+		for _, tr := range *torrents {
+			if id := q.Get("imdb_id"); id == "" || tr["imdb_id"] == id {
+				selected = append(selected, tr)
+			}
+		}
+		if len(selected) == 0 {
+			selected = *torrents
+		}
+		from, to := (page-1)*limit, page*limit
+		if from > len(selected) {
+			from = len(selected)
+		}
+		if to > len(selected) {
+			to = len(selected)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"imdb_id":        q.Get("imdb_id"),
+			"torrents_count": len(selected),
+			"limit":          limit,
+			"page":           page,
+			"torrents":       selected[from:to],
+		})
+	}))
+}
+
+func apiTorrent(id int, imdb, title string, season, episode int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                 id,
+		"hash":               fmt.Sprintf("%040X", id),
+		"filename":           title + ".mkv",
+		"episode_url":        fmt.Sprintf("https://eztv.re/ep/%d/", id),
+		"torrent_url":        fmt.Sprintf("https://zoink.ch/torrent/%d.torrent", id),
+		"magnet_url":         fmt.Sprintf("magnet:?xt=urn:btih:%040X", id),
+		"title":              title,
+		"imdb_id":            imdb,
+		"season":             strconv.Itoa(season),
+		"episode":            strconv.Itoa(episode),
+		"seeds":              id % 50,
+		"peers":              id % 70,
+		"date_released_unix": 1500000000 + id,
+		"size_bytes":         strconv.Itoa(id * 1000000),
+	}
+}
+
+func TestGetShowByImdbID(t *testing.T) {
+	var torrents []map[string]interface{}
+	for i := 250; i > 0; i-- {
+		title := fmt.Sprintf("Mr Robot S%02dE%02d 720p HDTV x264-KILLERS EZTV", 1+i/20, i%20)
+		if i%50 == 0 {
+			title = fmt.Sprintf("Mr.Robot.S%02dE%02d.1080p.WEB.h264-GRP", 1+i/20, i%20)
+		}
+		torrents = append(torrents, apiTorrent(i, "4158110", title, 1+i/20, i%20))
+		if i%10 == 0 {
+			torrents = append(torrents, apiTorrent(1000+i, "1234567", "Other Show S01E01 720p", 1, 1))
+		}
+	}
+	var requests int
+	srv := fakeAPI(t, &torrents, &requests)
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	show, err := c.GetShowByImdbID(ctx, "tt4158110")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if show.Title != "Mr Robot" || show.ImdbID != "tt4158110" {
+		t.Errorf("unexpected show %v", show)
+	}
+	if len(show.Episodes) != 250 {
+		t.Fatalf("expected 250 episodes, got %d", len(show.Episodes))
+	}
+	e := show.Episodes[0]
+	if e.Season != 1 || e.Episode != 1 || e.ShowTitle != "Mr Robot" {
+		t.Errorf("unexpected first episode %+v", e)
+	}
+	if e.Hash != fmt.Sprintf("%040x", 1) || e.Seeds != 1 || e.Peers != 1 || e.SizeBytes != 1000000 || e.Released.Unix() != 1500000001 {
+		t.Errorf("unexpected first episode %+v", e)
+	}
+
+	if _, err := c.GetShowByImdbID(ctx, "tt0000001"); err == nil {
+		t.Errorf("expected error for an unknown IMDb id")
+	}
+	if _, err := c.GetShowByImdbID(ctx, "tt"); err == nil {
+		t.Errorf("expected error for an invalid IMDb id")
+	}
+}
+
+func TestReleases(t *testing.T) {
+	var torrents []map[string]interface{}
+	for i := 250; i > 0; i-- {
+		torrents = append(torrents, apiTorrent(i, "4158110", fmt.Sprintf("Mr Robot S01E%02d", i), 1, i))
+	}
+	var requests int
+	srv := fakeAPI(t, &torrents, &requests)
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	// early stop: 150 releases need 2 pages, with no page skipped
+	it := c.Releases(ctx, ReleaseOptions{})
+	var ids []int
+	for len(ids) < 150 && it.Next() {
+		ids = append(ids, it.Release().ID)
+	}
+	if it.Err() != nil || requests != 2 || it.Pages() != 2 {
+		t.Errorf("expected 2 requests, got %d (%v)", requests, it.Err())
+	}
+	for i, id := range ids {
+		if id != 250-i {
+			t.Fatalf("expected release %d at %d, got %d", 250-i, i, id)
+		}
+	}
+
+	// all the releases, with a new one pushing the list while paging
+	requests = 0
+	it = c.Releases(ctx, ReleaseOptions{PageSize: 30})
+	n := 0
+	for it.Next() {
+		n++
+		if n == 10 {
+			torrents = append([]map[string]interface{}{apiTorrent(251, "4158110", "Mr Robot S01E251", 1, 251)}, torrents...)
+		}
+	}
+	if it.Err() != nil || n != 250 {
+		t.Errorf("expected 250 releases once each, got %d (%v)", n, it.Err())
+	}
+	if it.Next() {
+		t.Errorf("expected Next to stay false at the end")
+	}
+
+	// since cutoff
+	requests = 0
+	it = c.Releases(ctx, ReleaseOptions{Since: time.Unix(1500000000+200, 0)})
+	n = 0
+	for it.Next() {
+		n++
+	}
+	if n != 52 || requests != 1 {
+		t.Errorf("expected 52 releases in 1 request, got %d in %d", n, requests)
+	}
+
+	// page limit
+	requests = 0
+	it = c.Releases(ctx, ReleaseOptions{PageSize: 10, MaxPages: 3})
+	n = 0
+	for it.Next() {
+		n++
+	}
+	if n != 30 || requests != 3 {
+		t.Errorf("expected 30 releases in 3 requests, got %d in %d", n, requests)
+	}
+
+	// replies without torrents_count end with a short page
+	noCount := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		srv.Config.Handler.ServeHTTP(rec, r)
+		var reply map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+			t.Error(err)
+		}
+		delete(reply, "torrents_count")
+		json.NewEncoder(w).Encode(reply)
+	}))
+	defer noCount.Close()
+	requests = 0
+	it = newTestClient(noCount.URL).Releases(ctx, ReleaseOptions{})
+	n = 0
+	for it.Next() {
+		n++
+	}
+	if it.Err() != nil || n != 251 || requests != 3 {
+		t.Errorf("expected 251 releases in 3 requests, got %d in %d (%v)", n, requests, it.Err())
+	}
+}
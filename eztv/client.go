@@ -1,10 +1,10 @@
 package eztv
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -13,17 +13,239 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/arcimboldo/tv/httpcache"
+	"github.com/arcimboldo/tv/magnet"
+	"github.com/arcimboldo/tv/release"
+
 	"github.com/PuerkitoBio/goquery"
 )
 
 var (
-	eztvURL            string = "https://eztv.ag/api/get-torrents"
-	maxPageSize        int    = 100
-	defaultMovieRegexp string = "(?i)(.*)\\s*S?([0-9]+)[Ex]([0-9]+).*\\.(mkv|avi|mp4|asf|mov|flv|swf|qt|vob|ogg|ogv|yuv|mpg|mpg2|mpeg|mpv|m4v)"
+	maxPageSize int = 100
+	// videoRE matches the names of the video files of the episodes
+	videoRE = regexp.MustCompile(`(?i)\.(mkv|avi|mp4|asf|mov|flv|swf|qt|vob|ogg|ogv|yuv|mpg|mpg2|mpeg|mpv|m4v)$`)
 )
 
+// DefaultBaseURLs are the eztv mirrors used when none is configured.
+var DefaultBaseURLs = []string{
+	"https://eztv.ag",
+	"https://eztv.re",
+	"https://eztv.wf",
+	"https://eztv.tf",
+	"https://eztv.yt",
+}
+
+// Client fetches shows from eztv. Every request is tried on each of the
+// BaseURLs in turn, starting from the last one that worked, until one
+// replies with a proper page. Requests are paced and retried according
+// to the policy of the client.
+type Client struct {
+	HTTPClient *http.Client
+	BaseURLs   []string
+
+	mu        sync.Mutex
+	preferred int
+	policy    Policy
+	limiter   *limiter
+}
+
+// NewClient returns a client using a copy of hc, or a client with a one
+// minute timeout if hc is nil, and the given mirrors, or DefaultBaseURLs
+// if none is given. The client follows DefaultPolicy.
+func NewClient(hc *http.Client, baseURLs ...string) *Client {
+	if hc == nil {
+		hc = &http.Client{Timeout: time.Minute}
+	}
+	if len(baseURLs) == 0 {
+		baseURLs = DefaultBaseURLs
+	}
+	l := &limiter{interval: DefaultPolicy.Interval}
+	limited := *hc
+	limited.Transport = &limitedTransport{l: l, next: hc.Transport}
+	return &Client{HTTPClient: &limited, BaseURLs: baseURLs, policy: DefaultPolicy, limiter: l}
+}
+
+// WithBaseURLs returns a client fetching from the given mirrors, or
+// DefaultBaseURLs if none is given, with the HTTP client, cache and
+// policy of c. Both clients share the pace of the requests.
+func (c *Client) WithBaseURLs(baseURLs ...string) *Client {
+	if len(baseURLs) == 0 {
+		baseURLs = DefaultBaseURLs
+	}
+	return &Client{HTTPClient: c.HTTPClient, BaseURLs: baseURLs, policy: c.getPolicy(), limiter: c.limiter}
+}
+
+// DefaultCacheTTL are the times pages are cached by EnableCache: the
+// list of shows rarely changes, the latest releases often.
+var DefaultCacheTTL = map[string]time.Duration{
+	"/showlist/":        24 * time.Hour,
+	"/shows/":           time.Hour,
+	"/api/get-torrents": 10 * time.Minute,
+}
+
+// EnableCache caches the pages in dir, for the TTLs of DefaultCacheTTL
+// overridden by ttl. Keys of ttl are prefixes of the page paths. If dir
+// is empty the eztv directory in the user cache directory is used.
+func (c *Client) EnableCache(dir string, ttl map[string]time.Duration) error {
+	if dir == "" {
+		base, err := httpcache.DefaultDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(base, "eztv")
+	}
+	t := &httpcache.Transport{Dir: dir, TTL: make(map[string]time.Duration), Transport: c.HTTPClient.Transport}
+	// Cloudflare challenges may come with a 200
+	t.Valid = func(resp *http.Response, body []byte) bool {
+		return !isChallenge(resp, body)
+	}
+	for p, d := range DefaultCacheTTL {
+		t.TTL[p] = d
+	}
+	for p, d := range ttl {
+		t.TTL[p] = d
+	}
+	hc := *c.HTTPClient
+	hc.Transport = t
+	c.HTTPClient = &hc
+	return nil
+}
+
+// DefaultClient is used by the package level functions.
+var DefaultClient = NewClient(nil)
+
+// isChallenge returns true if the reply is a Cloudflare challenge page
+// instead of the requested content.
+func isChallenge(resp *http.Response, body []byte) bool {
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		return true
+	}
+	for _, marker := range []string{"<title>Just a moment...</title>", "cf-browser-verification", "/cdn-cgi/challenge-platform/"} {
+		if bytes.Contains(body, []byte(marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch gets path, which must start with "/", from base.
+func (c *Client) fetch(ctx context.Context, base, path string) ([]byte, error) {
+	u := strings.TrimRight(base, "/") + path
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &retryError{err: err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		// a truncated page
+		return nil, &retryError{err: err}
+	}
+	if isChallenge(resp, body) {
+		return nil, fmt.Errorf("got a Cloudflare challenge while fetching %s", u)
+	}
+	if resp.StatusCode != 200 {
+		err := fmt.Errorf("got error %d (%s) while fetching %s", resp.StatusCode, resp.Status, u)
+		if retryable(resp.StatusCode) {
+			return nil, &retryError{err: err, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		}
+		return nil, &pageError{err}
+	}
+	return body, nil
+}
+
+// pageError is an error reply that all the mirrors would give, e.g. 404
+// Not Found for a removed show.
+type pageError struct {
+	err error
+}
+
+func (e *pageError) Error() string {
+	return e.err.Error()
+}
+
+// get fetches path from the first mirror that replies properly, and
+// returns the page and the base URL of the mirror. The next mirror is
+// only tried after network errors, 429 and 5xx errors, and Cloudflare
+// challenges.
+func (c *Client) get(ctx context.Context, path string) ([]byte, string, error) {
+	if len(c.BaseURLs) == 0 {
+		return nil, "", fmt.Errorf("no eztv base URL configured")
+	}
+	c.mu.Lock()
+	first := c.preferred
+	c.mu.Unlock()
+
+	var errs []string
+	for i := range c.BaseURLs {
+		n := (first + i) % len(c.BaseURLs)
+		base := c.BaseURLs[n]
+		body, err := c.fetchRetry(ctx, base, path)
+		if err == nil {
+			c.mu.Lock()
+			c.preferred = n
+			c.mu.Unlock()
+			return body, base, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if _, ok := err.(*pageError); ok {
+			return nil, "", err
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, "", fmt.Errorf("all eztv mirrors failed: %s", strings.Join(errs, "; "))
+}
+
+// getDocument fetches and parses the HTML page at path.
+func (c *Client) getDocument(ctx context.Context, path string) (*goquery.Document, string, error) {
+	body, base, err := c.get(ctx, path)
+	if err != nil {
+		return nil, "", err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	return doc, base, err
+}
+
+// pagePath returns the path and query of URL, so that pages saved with
+// the URL of a mirror can be fetched from the others.
+func pagePath(URL string) (string, error) {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return "", err
+	}
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	return p, nil
+}
+
+// SamePage returns true if the two URLs point to the same page, possibly
+// on different mirrors.
+func SamePage(u1, u2 string) bool {
+	if u1 == "" || u2 == "" {
+		return false
+	}
+	p1, err1 := pagePath(u1)
+	p2, err2 := pagePath(u2)
+	return err1 == nil && err2 == nil && p1 == p2
+}
+
 type UnixTime struct {
 	time.Time
 }
@@ -57,10 +279,88 @@ type Episode struct {
 	Release    string
 	Downloaded bool
 	Path       string
+	// Hash is the info hash of the torrent, if known
+	Hash string
+	// SizeBytes is the size of the torrent, 0 if unknown
+	SizeBytes int64
+	// Seeds is the number of seeders, -1 if unknown
+	Seeds int
+	// Peers is the number of peers, -1 if unknown
+	Peers int
+	// Released is the release time, if known
+	Released time.Time
+	// Source is the name of the provider that found the episode
+	Source string
+	// Episodes are the episodes of a multi-episode release, nil for
+	// single episodes
+	Episodes []int
+	// AirDate is the date of daily shows, whose releases have the year
+	// as Season and month*100+day as Episode
+	AirDate time.Time
+	// Absolute is the number of the episode counting from the first
+	// one of the show, for releases numbered that way, e.g. anime
+	Absolute int
+	// Pack is true for the releases of a whole season, which have
+	// Episode -1
+	Pack bool
+	// Seasons are the seasons of packs of several seasons, whose Season
+	// is the first one
+	Seasons []int
 }
 
 func (e Episode) String() string {
-	return fmt.Sprintf("S%02d E%02d - %q - (%s) (%s)", e.Season, e.Episode, e.Title, e.Size, e.Release)
+	return fmt.Sprintf("%s - %q - (%s) (%s)", e.Number(), e.Title, e.Size, e.Release)
+}
+
+// Number returns the episode number as shown to the user, e.g.
+// "S01 E02", "S01 E02-E03", "2024-03-11", or "S01" and "S01-S03" for
+// season packs.
+func (e Episode) Number() string {
+	if !e.AirDate.IsZero() {
+		return e.AirDate.Format("2006-01-02")
+	}
+	if e.Pack && len(e.Seasons) > 1 {
+		return fmt.Sprintf("S%02d-S%02d", e.Seasons[0], e.Seasons[len(e.Seasons)-1])
+	}
+	if e.Pack {
+		return fmt.Sprintf("S%02d", e.Season)
+	}
+	n := fmt.Sprintf("S%02d E%02d", e.Season, e.Episode)
+	if len(e.Episodes) > 1 {
+		n += fmt.Sprintf("-E%02d", e.Episodes[len(e.Episodes)-1])
+	}
+	return n
+}
+
+// Numbers returns the episodes of the release: Episodes for
+// multi-episode releases, else Episode.
+func (e Episode) Numbers() []int {
+	if len(e.Episodes) > 0 {
+		return e.Episodes
+	}
+	return []int{e.Episode}
+}
+
+// SetRelease sets the numbers and the quality of the episode from the
+// parsed name of its release.
+func (e *Episode) SetRelease(r release.Info) {
+	e.Season = r.Season
+	e.Episode = r.Episode
+	e.Episodes = r.Episodes
+	e.AirDate = r.AirDate
+	e.Absolute = r.Absolute
+	e.Pack = r.Pack
+	e.Seasons = r.Seasons
+	e.Quality = r.Quality()
+}
+
+// DownloadURL returns the magnet link of the episode or, if missing,
+// the URL of the torrent file.
+func (e Episode) DownloadURL() string {
+	if e.MagnetURL != "" {
+		return e.MagnetURL
+	}
+	return e.TorrentURL
 }
 
 func (e Episode) Filename() string {
@@ -78,6 +378,10 @@ type Show struct {
 	URL      string
 	Rating   string
 	Episodes []*Episode
+	// Source is the name of the provider of the show page
+	Source string
+	// ImdbID is the IMDb id of the show, e.g. tt4158110, if known
+	ImdbID string
 }
 
 func (s Show) String() string {
@@ -87,6 +391,13 @@ URL:    %s
 Rating: %s`, s.Title, s.URL, s.Rating)
 }
 
+// SortEpisodes sorts the episodes by season and episode number.
+func (s *Show) SortEpisodes() {
+	sort.SliceStable(s.Episodes, func(i, j int) bool {
+		return s.Episodes[i].Season < s.Episodes[j].Season || (s.Episodes[i].Season == s.Episodes[j].Season && s.Episodes[i].Episode < s.Episodes[j].Episode)
+	})
+}
+
 func (s *Show) LatestEpisode() Episode {
 	latest := Episode{}
 	for _, e := range s.Episodes {
@@ -174,14 +485,18 @@ func (show *Show) getExistingEpisodes(basedir string) (map[int]map[int]string, e
 		if info.IsDir() {
 			return nil
 		}
-		re := regexp.MustCompile(defaultMovieRegexp)
-		if m := re.FindStringSubmatch(filepath.Base(path)); m != nil {
-			s, _ := strconv.Atoi(m[2])
-			e, _ := strconv.Atoi(m[3])
-			if _, ok := episodes[s]; !ok {
-				episodes[s] = make(map[int]string)
-			}
-			episodes[s][e] = path
+		if !videoRE.MatchString(path) {
+			return nil
+		}
+		var e Episode
+		if e.SetRelease(release.Parse(filepath.Base(path))); e.Season < 0 {
+			return nil
+		}
+		if _, ok := episodes[e.Season]; !ok {
+			episodes[e.Season] = make(map[int]string)
+		}
+		for _, n := range e.Numbers() {
+			episodes[e.Season][n] = path
 		}
 		return nil
 	}
@@ -207,6 +522,44 @@ type RSSShow struct {
 	Seeds           int      `json:"seeds"`
 	Peers           int      `json:"peers"`
 	Released        UnixTime `json:"date_released_unix"`
+	SizeBytes       int64    `json:"size_bytes,string"`
+}
+
+// FormatSize formats a size in bytes like eztv does, e.g. "1.20 GB".
+func FormatSize(n int64) string {
+	switch {
+	case n <= 0:
+		return ""
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GB", float64(n)/(1<<30))
+	default:
+		return fmt.Sprintf("%.2f MB", float64(n)/(1<<20))
+	}
+}
+
+// AsEpisode returns the release as an Episode. ShowTitle and ShowURL are
+// left empty.
+func (s RSSShow) AsEpisode() Episode {
+	e := Episode{
+		Title:      s.Title,
+		EpisodeURL: s.EpisodeURL,
+		TorrentURL: s.TorrentURL,
+		MagnetURL:  s.MagnetURL,
+		Hash:       strings.ToLower(s.Hash),
+		Size:       FormatSize(s.SizeBytes),
+		SizeBytes:  s.SizeBytes,
+		Seeds:      s.Seeds,
+		Peers:      s.Peers,
+		Released:   s.Released.Time,
+		Release:    s.Released.Format("2006-01-02 15:04"),
+	}
+	e.SetRelease(release.Parse(s.Title))
+	// the numbers of the API are more reliable than the title, except
+	// for daily and absolute numbering and packs, which it does not know
+	if (s.Season > 0 || s.Episode > 0) && e.AirDate.IsZero() && e.Absolute == 0 && !e.Pack {
+		e.Season, e.Episode = s.Season, s.Episode
+	}
+	return e
 }
 
 func (s RSSShow) String() string {
@@ -219,95 +572,25 @@ Filename:  %s`, s.Title, s.Season, s.Episode, s.Released, s.EpisodeURL, s.Filena
 	return msg
 }
 
-// LatestShow gets latest n show from EZTV rss
-func LatestShows(n int) ([]RSSShow, error) {
-
-	shows := []RSSShow{}
-
-	if n > maxPageSize {
-		var p int
-		for p = 1; p*maxPageSize < n; p++ {
-			showpage, err := lastShowsPaged(maxPageSize, p)
-			if err != nil {
-				return shows, err
-			}
-			shows = append(shows, showpage...)
-		}
-		remain := n - (p-1)*maxPageSize
-		showpage, err := lastShowsPaged(maxPageSize, p+1)
-		if err != nil {
-			return shows, err
-		}
-		for i := 0; i < remain; i++ {
-			shows = append(shows, showpage[i])
-		}
-		return shows, nil
-	}
-	return lastShowsPaged(n, 1)
+// ListShows lists all the shows on eztv, using DefaultClient
+func ListShows(ctx context.Context) ([]Show, error) {
+	return DefaultClient.ListShows(ctx)
 }
 
-func lastShowsPaged(n, p int) ([]RSSShow, error) {
-	u := fmt.Sprintf("%s?limit=%d&page=%d", eztvURL, n, p)
-	resp, err := http.Get(u)
+func (c *Client) ListShows(ctx context.Context) ([]Show, error) {
+	var shows []Show
+	doc, base, err := c.getDocument(ctx, "/showlist/")
 	if err != nil {
-		return []RSSShow{}, err
-	}
-	defer resp.Body.Close()
-	var s struct {
-		Torrents []RSSShow `json:"torrents"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&s)
-	return s.Torrents, err
-
-}
-
-// LastMatching gets the latest show for which the function returns true
-func LastMatching(f func(RSSShow) bool) (RSSShow, error) {
-	shows, err := LastMatchingN(1, f)
-	if len(shows) == 0 {
-		return RSSShow{}, err
-	}
-	return shows[0], err
-}
-
-func LastMatchingN(n int, f func(RSSShow) bool) ([]RSSShow, error) {
-	shows := []RSSShow{}
-	maxpages := 50
-	for p := 1; p <= maxpages && n > 0; p++ {
-		pageshows, err := lastShowsPaged(maxPageSize, p)
-		if p%10 == 0 {
-			log.Printf("Page %d", p)
-		}
-		if err != nil {
-			return shows, err
-		}
-		for _, show := range pageshows {
-			if f(show) {
-				shows = append(shows, show)
-				n--
-				if n == 0 {
-					break
-				}
-			}
-		}
-	}
-	if len(shows) < n {
-		return shows, fmt.Errorf("After %d results only %d matching your requests.", maxPageSize*maxpages, len(shows))
+		return shows, err
 	}
-	return shows, nil
-}
-
-func ListShows() ([]Show, error) {
-	var shows []Show
-	u, _ := url.Parse("https://eztv.ag/showlist/")
-	doc, err := goquery.NewDocument(u.String())
+	u, err := url.Parse(base)
 	if err != nil {
 		return shows, err
 	}
 
 	doc.Find("table tbody tr td.forum_thread_post a").Each(func(i int, s *goquery.Selection) {
 		path, _ := s.Attr("href")
-		showUrl := u
+		showUrl := *u
 		showUrl.Path = path
 		title := s.Text()
 
@@ -318,26 +601,41 @@ func ListShows() ([]Show, error) {
 	return shows, nil
 }
 
-func parseTitle(s string) (title string, season, episode int) {
-	re := regexp.MustCompile("(?i)(.*[^\\s]*)\\s*S?([0-9]+)[Ex]([0-9]+).*")
-	m := re.FindStringSubmatch(s)
-	if m == nil {
-		return s, -1, -1
-	}
-	title = m[1]
-	season, _ = strconv.Atoi(m[2])
-	episode, _ = strconv.Atoi(m[3])
-	return title, season, episode
+// ParseTitle splits a release name like "Show Name S01E02 720p" in the
+// title of the show, the season and the episode. Season and episode are
+// -1 if the name has no episode number. See release.Parse for the other
+// properties of the release.
+func ParseTitle(s string) (title string, season, episode int) {
+	r := release.Parse(s)
+	return r.Title, r.Season, r.Episode
 }
 
-func GetShow(URL string) (Show, error) {
+var imdbRE = regexp.MustCompile("tt[0-9]+")
+
+// GetShow gets a show and its episodes from its eztv page, using
+// DefaultClient
+func GetShow(ctx context.Context, URL string) (Show, error) {
+	return DefaultClient.GetShow(ctx, URL)
+}
+
+// GetShow gets a show and its episodes from its eztv page. The page is
+// fetched from any of the mirrors, regardless of the host in URL.
+func (c *Client) GetShow(ctx context.Context, URL string) (Show, error) {
 	show := Show{URL: URL}
-	doc, err := goquery.NewDocument(URL)
+	path, err := pagePath(URL)
+	if err != nil {
+		return show, err
+	}
+	doc, base, err := c.getDocument(ctx, path)
 	if err != nil {
 		return show, err
 	}
+	URL = strings.TrimRight(base, "/") + path
 	show.Title = doc.Find("td h1 b span").First().Text()
 	show.Rating = doc.Find("b span[itemprop=ratingValue]").First().Text()
+	if imdb, ok := doc.Find(`a[href*="imdb.com/title/"]`).First().Attr("href"); ok {
+		show.ImdbID = imdbRE.FindString(imdb)
+	}
 
 	doc.Find("table tbody tr").Each(func(i int, sel *goquery.Selection) {
 		if sel.Find("td").Size() != 6 {
@@ -349,33 +647,35 @@ func GetShow(URL string) (Show, error) {
 		// <empty> | title | url | size | released
 		title := sel.Find("td.forum_thread_post a.epinfo").Text()
 		path, _ := sel.Find("td.forum_thread_post a.epinfo").Attr("href")
-		magnet, _ := sel.Find("td.forum_thread_post a.magnet").Attr("href")
+		magnetURL, _ := sel.Find("td.forum_thread_post a.magnet").Attr("href")
 		torrent, _ := sel.Find("td.forum_thread_post a.download_1").Attr("href")
 		size := sel.Find("td").Eq(3).Text()
-		release := sel.Find("td").Eq(4).Text()
+		released := sel.Find("td").Eq(4).Text()
+		seeds, err := strconv.Atoi(strings.TrimSpace(sel.Find("td").Eq(5).Text()))
+		if err != nil {
+			seeds = -1
+		}
 
 		u, _ := url.Parse(URL)
 		u.Path = path
-		_, s, e := parseTitle(title)
 		ep := Episode{
 			Title:      title,
-			Season:     s,
-			Episode:    e,
-			MagnetURL:  magnet,
+			MagnetURL:  magnetURL,
 			TorrentURL: torrent,
 			EpisodeURL: u.String(),
 			ShowTitle:  show.Title,
 			ShowURL:    URL,
 			Size:       size,
-			Release:    release,
+			Release:    released,
+			Hash:       magnet.Hash(magnetURL),
+			Seeds:      seeds,
+			Peers:      -1,
 		}
+		ep.SetRelease(release.Parse(title))
 		show.Episodes = append(show.Episodes, &ep)
 	})
 
-	// Sort episodes
-	sort.Slice(show.Episodes, func(i, j int) bool {
-		return show.Episodes[i].Season < show.Episodes[j].Season || (show.Episodes[i].Season == show.Episodes[j].Season && show.Episodes[i].Episode < show.Episodes[j].Episode)
-	})
+	show.SortEpisodes()
 	// for i, j := 0, len(show.Episodes)-1; i < j; i, j = i+1, j-1 {
 	// 	show.Episodes[i], show.Episodes[j] = show.Episodes[j], show.Episodes[i]
 	// }
@@ -1,6 +1,18 @@
 package eztv
 
-import "testing"
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
 
 func Test_fuzzyPathMatching(t *testing.T) {
 	tests := []struct {
@@ -26,3 +38,251 @@ func Test_fuzzyPathMatching(t *testing.T) {
 	}
 
 }
+
+const showPage = `<html><body><table>
+<tr><td><h1><b><span>Mr Robot</span></b></h1></td></tr>
+<tr><td><b><span itemprop="ratingValue">8.5</span></b></td></tr>
+</table>
+<table><tbody>
+<tr><td></td>
+<td class="forum_thread_post"><a class="epinfo" href="/ep/2/mr-robot-s03e02/">Mr Robot S03E02 720p HDTV x264-KILLERS</a></td>
+<td class="forum_thread_post"><a class="magnet" href="magnet:?xt=urn:btih:2222">m</a><a class="download_1" href="https://zoink.ch/torrent/Mr.Robot.S03E02.720p.HDTV.x264-KILLERS[eztv].mkv.torrent">t</a></td>
+<td>500 MB</td><td>1 week</td><td>10</td></tr>
+<tr><td></td>
+<td class="forum_thread_post"><a class="epinfo" href="/ep/1/mr-robot-s03e01/">Mr Robot S03E01 720p HDTV x264-KILLERS</a></td>
+<td class="forum_thread_post"><a class="magnet" href="magnet:?xt=urn:btih:1111">m</a></td>
+<td>490 MB</td><td>2 weeks</td><td>10</td></tr>
+</tbody></table></body></html>`
+
+func TestGetShow(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shows/1/mr-robot/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(showPage))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newTestClient(srv.URL)
+	show, err := c.GetShow(ctx, "https://eztv.ag/shows/1/mr-robot/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if show.Title != "Mr Robot" || show.Rating != "8.5" {
+		t.Errorf("unexpected show %v", show)
+	}
+	if len(show.Episodes) != 2 {
+		t.Fatalf("expected 2 episodes, got %d", len(show.Episodes))
+	}
+	e := show.Episodes[0]
+	if e.Season != 3 || e.Episode != 1 || e.MagnetURL != "magnet:?xt=urn:btih:1111" || e.Size != "490 MB" || e.Seeds != 10 || e.Quality != "720p HDTV x264" {
+		t.Errorf("unexpected first episode %+v", e)
+	}
+	if e.EpisodeURL != srv.URL+"/ep/1/mr-robot-s03e01/" {
+		t.Errorf("unexpected episode URL %q", e.EpisodeURL)
+	}
+
+	if _, err := c.GetShow(ctx, srv.URL+"/shows/2/missing/"); err == nil {
+		t.Errorf("expected error for a missing show")
+	}
+}
+
+func TestContext(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := newTestClient(srv.URL).GetShow(ctx, srv.URL); err == nil {
+		t.Errorf("expected error from a cancelled request")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	var challenged, served int
+	cf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		challenged++
+		w.Header().Set("Server", "cloudflare")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`<html><head><title>Just a moment...</title></head><body><script src="/cdn-cgi/challenge-platform/h/b/orchestrate/jsch/v1"></script></body></html>`))
+	}))
+	defer cf.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.Write([]byte(showPage))
+	}))
+	defer mirror.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	ctx := context.Background()
+	c := newTestClient(down.URL, cf.URL, mirror.URL)
+	for i := 0; i < 2; i++ {
+		show, err := c.GetShow(ctx, cf.URL+"/shows/1/mr-robot/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if show.URL != cf.URL+"/shows/1/mr-robot/" {
+			t.Errorf("unexpected show URL %q", show.URL)
+		}
+		if e := show.Episodes[0]; e.EpisodeURL != mirror.URL+"/ep/1/mr-robot-s03e01/" {
+			t.Errorf("unexpected episode URL %q", e.EpisodeURL)
+		}
+	}
+	// the second request goes straight to the working mirror
+	if challenged != 1 || served != 2 {
+		t.Errorf("expected 1 challenge and 2 pages served, got %d and %d", challenged, served)
+	}
+
+	c = newTestClient(down.URL, cf.URL)
+	if _, err := c.GetShow(ctx, "/shows/1/mr-robot/"); err == nil || !strings.Contains(err.Error(), "Cloudflare") {
+		t.Errorf("expected challenge error, got %v", err)
+	}
+
+	// a removed show is missing on all the mirrors
+	removed := httptest.NewServer(http.NotFoundHandler())
+	defer removed.Close()
+	served = 0
+	c = newTestClient(removed.URL, mirror.URL)
+	if _, err := c.GetShow(ctx, "/shows/2/removed/"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if served != 0 {
+		t.Errorf("expected no request to the other mirror, got %d", served)
+	}
+}
+
+func TestSamePage(t *testing.T) {
+	if !SamePage("https://eztv.ag/shows/1/mr-robot/", "https://eztv.re/shows/1/mr-robot/") {
+		t.Errorf("expected same page on different mirrors")
+	}
+	if SamePage("https://eztv.ag/shows/1/mr-robot/", "https://eztv.ag/shows/2/mr-robot/") {
+		t.Errorf("expected different pages")
+	}
+}
+
+func TestParseTitle(t *testing.T) {
+	tests := []struct {
+		in      string
+		title   string
+		season  int
+		episode int
+	}{
+		{"Mr Robot S03E01 720p HDTV x264-KILLERS", "Mr Robot", 3, 1},
+		{"Show.Name.S10E02.1080p.WEB.h264-GRP", "Show Name", 10, 2},
+		{"The 100 S01E02", "The 100", 1, 2},
+		{"Show - 1x02 HDTV", "Show", 1, 2},
+		{"Show Name Complete", "Show Name Complete", -1, -1},
+	}
+	for _, test := range tests {
+		title, s, e := ParseTitle(test.in)
+		if title != test.title || s != test.season || e != test.episode {
+			t.Errorf("ParseTitle(%q) = %q, %d, %d, expected %q, %d, %d", test.in, title, s, e, test.title, test.season, test.episode)
+		}
+	}
+}
+
+func TestGetDownloadedEpisodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eztv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := []string{
+		"S01/Show.Name.S01E01E02.720p.HDTV.x264-GRP.mkv",
+		"S01/Show.Name.S01E05-E07.720p.HDTV.x264-GRP.mkv",
+		"S10/Show.Name.S10E02.1080p.WEB.h264-GRP.mkv",
+		"S00/Show.Name.S00E03.Special.mkv",
+		"S2024/Show.Name.2024.03.11.Guest.720p.WEB.mkv",
+		"S01/[Group] Show Name - 105 [1080p].mkv",
+		"S01/Show.Name.S01E09.nfo",
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, "Show Name", f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	show := Show{Title: "Show Name"}
+	got := make(map[int][]int)
+	for s, eps := range show.GetDownloadedEpisodes(dir) {
+		for e := range eps {
+			got[s] = append(got[s], e)
+		}
+	}
+	for _, eps := range got {
+		sort.Ints(eps)
+	}
+	expect := map[int][]int{
+		0:    {3},
+		1:    {1, 2, 5, 6, 7, 105},
+		10:   {2},
+		2024: {311},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected episodes %v, got %v", expect, got)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/shows/3/mr-robot/" && requests == 1 {
+			w.Write([]byte(`<html><head><title>Just a moment...</title></head></html>`))
+			return
+		}
+		w.Write([]byte(showPage))
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "eztv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	c := newTestClient(srv.URL)
+	if err := c.EnableCache(dir, map[string]time.Duration{"/shows/2/": 0}); err != nil {
+		t.Fatal(err)
+	}
+	// challenges are not cached
+	if _, err := c.GetShow(ctx, srv.URL+"/shows/3/mr-robot/"); err == nil {
+		t.Fatal("expected challenge error")
+	}
+	if _, err := c.GetShow(ctx, srv.URL+"/shows/3/mr-robot/"); err != nil {
+		t.Fatal(err)
+	}
+	requests = 0
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetShow(ctx, srv.URL+"/shows/1/mr-robot/"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetShow(ctx, srv.URL+"/shows/2/mr-robot/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// show 2 is never fresh and has no validators
+	if requests != 4 {
+		t.Errorf("expected 4 requests, got %d", requests)
+	}
+
+	// clients for other mirrors share the cache
+	requests = 0
+	if _, err := c.WithBaseURLs(srv.URL).GetShow(ctx, srv.URL+"/shows/1/mr-robot/"); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Errorf("expected the cached page, got %d requests", requests)
+	}
+}
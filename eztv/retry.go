@@ -0,0 +1,185 @@
+package eztv
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Policy sets the pace of the requests to eztv and the retries of the
+// failed ones.
+type Policy struct {
+	// Interval is the minimum time between two requests, shared by all
+	// the goroutines using the client. Cached pages do not count.
+	Interval time.Duration
+	// Retries is the number of times a request is retried on a mirror
+	// after network errors, 429 Too Many Requests and 5xx errors, before
+	// trying the next mirror.
+	Retries int
+	// MinBackoff is the wait before the first retry, doubled at each
+	// retry up to MaxBackoff. Waits are randomized by up to 50%. A
+	// Retry-After header given by the server is respected; if it is
+	// longer than MaxBackoff the next mirror is tried instead.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultPolicy is used by NewClient.
+var DefaultPolicy = Policy{
+	Interval:   500 * time.Millisecond,
+	Retries:    3,
+	MinBackoff: time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// backoff returns the wait before retry n, counting from 0.
+func (p Policy) backoff(n int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	d := p.MinBackoff
+	for i := 0; i < n && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// full jitter on the upper half, so that concurrent clients do not
+	// retry together
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// limiter spaces out requests by a minimum interval.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *limiter) setInterval(d time.Duration) {
+	l.mu.Lock()
+	l.interval = d
+	l.mu.Unlock()
+}
+
+// wait blocks until the caller may send a request.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	t := l.next
+	if t.Before(now) {
+		t = now
+	}
+	l.next = t.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limitedTransport waits for the limiter before each request.
+type limitedTransport struct {
+	l    *limiter
+	next http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.l.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// SetPolicy changes the policy of the client.
+func (c *Client) SetPolicy(p Policy) {
+	c.mu.Lock()
+	c.policy = p
+	c.mu.Unlock()
+	c.limiter.setInterval(p.Interval)
+}
+
+func (c *Client) getPolicy() Policy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.policy
+}
+
+// retryError is a failure worth retrying on the same mirror.
+type retryError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryError) Error() string {
+	return e.err.Error()
+}
+
+// retryable returns true for the HTTP status worth retrying.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || (status >= 500 && status != http.StatusNotImplemented)
+}
+
+// parseRetryAfter parses a Retry-After header, given in seconds or as a
+// date.
+func parseRetryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(h); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// fetchRetry calls fetch, retrying as set by the policy.
+func (c *Client) fetchRetry(ctx context.Context, base, path string) ([]byte, error) {
+	p := c.getPolicy()
+	for n := 0; ; n++ {
+		body, err := c.fetch(ctx, base, path)
+		re, ok := err.(*retryError)
+		if !ok {
+			return body, err
+		}
+		if p.MaxBackoff > 0 && re.retryAfter > p.MaxBackoff {
+			// retrying earlier than asked only gets us throttled more
+			return nil, fmt.Errorf("%v, retry after %v", re.err, re.retryAfter.Round(time.Second))
+		}
+		if n >= p.Retries || ctx.Err() != nil {
+			if n > 0 {
+				return nil, fmt.Errorf("%v, after %d retries", re.err, n)
+			}
+			return nil, re.err
+		}
+		timer := time.NewTimer(p.backoff(n, re.retryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package eztv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client that neither waits between requests
+// nor retries.
+func newTestClient(baseURLs ...string) *Client {
+	c := NewClient(nil, baseURLs...)
+	c.SetPolicy(Policy{})
+	return c
+}
+
+func TestRetry(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests <= failures {
+			if requests == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+			} else {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+			return
+		}
+		w.Write([]byte(showPage))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := NewClient(nil, srv.URL)
+	c.SetPolicy(Policy{Retries: 2, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	start := time.Now()
+	if _, err := c.GetShow(ctx, "/shows/1/mr-robot/"); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 || time.Since(start) > 5*time.Second {
+		t.Errorf("expected 3 requests, got %d in %v", requests, time.Since(start))
+	}
+
+	requests, failures = 0, 10
+	if _, err := c.GetShow(ctx, "/shows/1/mr-robot/"); err == nil {
+		t.Errorf("expected error after the retries")
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+
+	// a Retry-After longer than MaxBackoff moves to the next mirror
+	var throttled int
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		throttled++
+		mu.Unlock()
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer slow.Close()
+	requests, failures = 0, 0
+	c = NewClient(nil, slow.URL, srv.URL)
+	c.SetPolicy(Policy{Retries: 2, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	start = time.Now()
+	if _, err := c.GetShow(ctx, "/shows/1/mr-robot/"); err != nil {
+		t.Fatal(err)
+	}
+	if throttled != 1 || requests != 1 || time.Since(start) > 5*time.Second {
+		t.Errorf("expected 1 throttled request and 1 request, got %d and %d in %v", throttled, requests, time.Since(start))
+	}
+
+	// not found is not retried
+	requests = 0
+	c = NewClient(nil, srv.URL)
+	c.SetPolicy(Policy{Retries: 2})
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		http.NotFound(w, r)
+	})
+	if _, err := c.GetShow(ctx, "/shows/1/mr-robot/"); err == nil || requests != 1 {
+		t.Errorf("expected error after 1 request, got %v after %d", err, requests)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(showPage))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := NewClient(nil, srv.URL)
+	c.SetPolicy(Policy{Interval: 20 * time.Millisecond})
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetShow(ctx, "/shows/1/mr-robot/"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("6 requests took %v, expected at least 100ms", d)
+	}
+
+	// waiting is interrupted by the context
+	c.SetPolicy(Policy{Interval: time.Hour})
+	c.GetShow(ctx, "/shows/1/mr-robot/")
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetShow(ctx, "/shows/1/mr-robot/"); err == nil {
+		t.Errorf("expected error from the context")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for n, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		d := p.backoff(n, 0)
+		if d < max/2 || d > max {
+			t.Errorf("backoff %d: expected between %v and %v, got %v", n, max/2, max, d)
+		}
+	}
+	if d := p.backoff(0, 3*time.Second); d != 3*time.Second {
+		t.Errorf("expected Retry-After to be used, got %v", d)
+	}
+	if d := parseRetryAfter("7"); d != 7*time.Second {
+		t.Errorf("expected 7s, got %v", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d < 50*time.Second || d > time.Minute {
+		t.Errorf("expected about a minute, got %v", d)
+	}
+}
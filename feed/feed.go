@@ -0,0 +1,216 @@
+// Package feed reads RSS and Atom feeds of torrents, like the personal
+// feeds of private trackers.
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arcimboldo/tv/magnet"
+)
+
+// Item is a torrent of a feed.
+type Item struct {
+	Title      string
+	Link       string
+	GUID       string
+	Published  time.Time
+	Size       int64
+	TorrentURL string
+	MagnetURL  string
+	InfoHash   string
+	// Seeders is -1 if the feed does not give it.
+	Seeders int
+}
+
+// rssItem holds the elements of an RSS item, including the extensions
+// of ezRSS (torrent:) and nyaa (nyaa:), matched by local name.
+type rssItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	GUID      string `xml:"guid"`
+	PubDate   string `xml:"pubDate"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	Description   string `xml:"description"`
+	ContentLength int64  `xml:"contentLength"`
+	InfoHash      string `xml:"infoHash"`
+	MagnetURI     string `xml:"magnetURI"`
+	Seeders       string `xml:"seeders"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href   string `xml:"href,attr"`
+		Rel    string `xml:"rel,attr"`
+		Type   string `xml:"type,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"link"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Summary   string `xml:"summary"`
+	Content   string `xml:"content"`
+}
+
+var magnetRE = regexp.MustCompile(`magnet:\?[^"'<>\s]+`)
+
+// isTorrent returns true if the link, of the given MIME type, points to
+// a .torrent file.
+func isTorrent(link, mimeType string) bool {
+	if mimeType == "application/x-bittorrent" {
+		return true
+	}
+	u := strings.ToLower(link)
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	return strings.HasSuffix(u, ".torrent")
+}
+
+// finish fills the magnet link and the hash from the other fields.
+func (it *Item) finish(text string) {
+	if it.MagnetURL == "" {
+		if m := magnetRE.FindString(text); m != "" {
+			it.MagnetURL = strings.Replace(m, "&amp;", "&", -1)
+		}
+	}
+	if it.InfoHash == "" {
+		it.InfoHash = magnet.Hash(it.MagnetURL)
+	}
+	it.InfoHash = strings.ToLower(it.InfoHash)
+}
+
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (x rssItem) item() Item {
+	it := Item{
+		Title:     strings.TrimSpace(x.Title),
+		Link:      strings.TrimSpace(x.Link),
+		GUID:      strings.TrimSpace(x.GUID),
+		Published: parseTime(x.PubDate),
+		Size:      x.ContentLength,
+		MagnetURL: x.MagnetURI,
+		InfoHash:  x.InfoHash,
+		Seeders:   -1,
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(x.Seeders)); err == nil {
+		it.Seeders = n
+	}
+	if it.Size == 0 {
+		it.Size = x.Enclosure.Length
+	}
+	for _, link := range []string{x.Enclosure.URL, it.Link} {
+		switch {
+		case link == "":
+		case strings.HasPrefix(link, "magnet:"):
+			if it.MagnetURL == "" {
+				it.MagnetURL = link
+			}
+		case it.TorrentURL == "" && (link == x.Enclosure.URL || isTorrent(link, "")):
+			it.TorrentURL = link
+		}
+	}
+	it.finish(x.Description)
+	return it
+}
+
+func (x atomEntry) item() Item {
+	it := Item{
+		Title:   strings.TrimSpace(x.Title),
+		GUID:    strings.TrimSpace(x.ID),
+		Seeders: -1,
+	}
+	it.Published = parseTime(x.Published)
+	if it.Published.IsZero() {
+		it.Published = parseTime(x.Updated)
+	}
+	for _, l := range x.Links {
+		switch {
+		case strings.HasPrefix(l.Href, "magnet:"):
+			if it.MagnetURL == "" {
+				it.MagnetURL = l.Href
+			}
+		case l.Rel == "enclosure" || isTorrent(l.Href, l.Type):
+			if it.TorrentURL == "" {
+				it.TorrentURL = l.Href
+				it.Size = l.Length
+			}
+		case l.Rel == "" || l.Rel == "alternate":
+			if it.Link == "" {
+				it.Link = l.Href
+			}
+		}
+	}
+	it.finish(x.Content + " " + x.Summary)
+	return it
+}
+
+// Parse reads an RSS or Atom feed.
+func Parse(r io.Reader) ([]Item, error) {
+	var doc struct {
+		XMLName xml.Name
+		Items   []rssItem   `xml:"channel>item"`
+		Entries []atomEntry `xml:"entry"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid feed: %v", err)
+	}
+	var items []Item
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, x := range doc.Items {
+			items = append(items, x.item())
+		}
+	case "feed":
+		for _, x := range doc.Entries {
+			items = append(items, x.item())
+		}
+	default:
+		return nil, fmt.Errorf("invalid feed: unknown root element %q", doc.XMLName.Local)
+	}
+	return items, nil
+}
+
+// DefaultHTTPClient is used when Fetch is given a nil *http.Client.
+var DefaultHTTPClient = &http.Client{Timeout: time.Minute}
+
+// Fetch gets and parses the feed at URL, using hc or DefaultHTTPClient
+// if hc is nil.
+func Fetch(ctx context.Context, hc *http.Client, URL string) ([]Item, error) {
+	if hc == nil {
+		hc = DefaultHTTPClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("got error %d (%s) while fetching %s", resp.StatusCode, resp.Status, URL)
+	}
+	return Parse(resp.Body)
+}
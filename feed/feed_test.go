@@ -0,0 +1,85 @@
+package feed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFile(t *testing.T, name string) []Item {
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	items, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestParseRSS(t *testing.T) {
+	items := parseFile(t, "rss.xml")
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+
+	it := items[0]
+	if it.TorrentURL != "https://tracker.example/download/2002/Mr.Robot.S03E02.torrent?passkey=secret" || it.MagnetURL != "" || it.InfoHash != "" {
+		t.Errorf("unexpected links in %+v", it)
+	}
+	if it.Size != 2147483648 || it.Seeders != -1 || !it.Published.Equal(time.Date(2017, 10, 19, 3, 2, 0, 0, time.UTC)) {
+		t.Errorf("unexpected item %+v", it)
+	}
+
+	it = items[1]
+	if it.MagnetURL != "magnet:?xt=urn:btih:BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB&dn=Mr+Robot" || it.InfoHash != "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" {
+		t.Errorf("unexpected magnet in %+v", it)
+	}
+	if it.TorrentURL != "https://zoink.example/Mr.Robot.S03E01.720p.HDTV.x264-KILLERS.torrent" || it.Size != 513802240 || it.Published.IsZero() {
+		t.Errorf("unexpected item %+v", it)
+	}
+
+	it = items[2]
+	if it.MagnetURL != "magnet:?xt=urn:btih:cccccccccccccccccccccccccccccccccccccccc&dn=Some+Anime" || it.Seeders != 120 || it.TorrentURL != "https://nyaa.example/download/3003.torrent" {
+		t.Errorf("unexpected item %+v", it)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	items := parseFile(t, "atom.xml")
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+	it := items[0]
+	if it.Link != "https://tracker.example/details/4004" || it.TorrentURL != "https://tracker.example/get/4004.torrent" || it.Size != 734003200 {
+		t.Errorf("unexpected links in %+v", it)
+	}
+	if it.InfoHash != "dddddddddddddddddddddddddddddddddddddddd" || it.Published.IsZero() {
+		t.Errorf("unexpected item %+v", it)
+	}
+	if it := items[1]; it.MagnetURL != "magnet:?xt=urn:btih:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee&dn=Other" {
+		t.Errorf("unexpected magnet in %+v", it)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+	ctx := context.Background()
+	if items, err := Fetch(ctx, nil, srv.URL+"/atom.xml"); err != nil || len(items) != 2 {
+		t.Errorf("expected 2 items, got %d (%v)", len(items), err)
+	}
+	if _, err := Fetch(ctx, nil, srv.URL+"/missing.xml"); err == nil {
+		t.Errorf("expected error for a missing feed")
+	}
+	if _, err := Parse(strings.NewReader("<html><body>not a feed</body></html>")); err == nil {
+		t.Errorf("expected error for an HTML page")
+	}
+}
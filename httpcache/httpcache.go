@@ -0,0 +1,196 @@
+// Package httpcache is an on-disk cache of HTTP responses, used as the
+// Transport of an http.Client.
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Transport caches the successful replies to GET requests in Dir. A
+// cached reply is used without contacting the server while younger than
+// the TTL of its URL. Older replies are revalidated with their ETag or
+// Last-Modified header, if any, and refreshed when the server replies
+// 304 Not Modified. The Cache-Control headers of the server are ignored,
+// the TTLs decide.
+type Transport struct {
+	// Dir is where the replies are stored.
+	Dir string
+	// TTL maps URL path prefixes to the time replies are used without
+	// revalidation. The longest matching prefix wins.
+	TTL map[string]time.Duration
+	// DefaultTTL is used for the paths not in TTL.
+	DefaultTTL time.Duration
+	// Transport sends the requests, http.DefaultTransport if nil.
+	Transport http.RoundTripper
+	// Valid, if set, is called with the successful replies and their
+	// body before storing them. Replies for which it returns false are
+	// not cached, e.g. error pages sent with a 200.
+	Valid func(resp *http.Response, body []byte) bool
+}
+
+// CacheHeader is set on the replies coming from the cache, to "hit" if
+// the server was not contacted and to "revalidated" after a 304.
+const CacheHeader = "X-Httpcache"
+
+// DefaultDir returns the ezupdate directory in the user cache directory,
+// $XDG_CACHE_HOME/ezupdate or ~/.cache/ezupdate on Linux.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ezupdate"), nil
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// ttl returns the TTL of the request URL.
+func (t *Transport) ttl(req *http.Request) time.Duration {
+	var prefixes []string
+	for p := range t.TTL {
+		if strings.HasPrefix(req.URL.Path, p) {
+			prefixes = append(prefixes, p)
+		}
+	}
+	if len(prefixes) == 0 {
+		return t.DefaultTTL
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return t.TTL[prefixes[0]]
+}
+
+func (t *Transport) path(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String()))
+	return filepath.Join(t.Dir, hex.EncodeToString(sum[:]))
+}
+
+// load returns the cached reply to req and when it was stored.
+func (t *Transport) load(req *http.Request) (*http.Response, time.Time, error) {
+	data, err := ioutil.ReadFile(t.path(req))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	fi, err := os.Stat(t.path(req))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	return resp, fi.ModTime(), err
+}
+
+// store saves the reply, unless it is not valid, and returns a copy of it
+// as the body is consumed.
+func (t *Transport) store(req *http.Request, resp *http.Response) (*http.Response, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if t.Valid != nil && !t.Valid(resp, body) {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+	data, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.Dir, 0755); err == nil {
+		// write and rename, so concurrent readers never see a partial
+		// file; a failure only means no caching
+		if f, err := ioutil.TempFile(t.Dir, ".tmp-"); err == nil {
+			_, werr := f.Write(data)
+			cerr := f.Close()
+			if werr != nil || cerr != nil || os.Rename(f.Name(), t.path(req)) != nil {
+				os.Remove(f.Name())
+			}
+		}
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+}
+
+// touch marks the cached reply as fresh.
+func (t *Transport) touch(req *http.Request) {
+	now := time.Now()
+	os.Chtimes(t.path(req), now, now)
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || req.Header.Get("Range") != "" {
+		return t.transport().RoundTrip(req)
+	}
+	cached, stored, err := t.load(req)
+	if err == nil && time.Since(stored) < t.ttl(req) {
+		cached.Header.Set(CacheHeader, "hit")
+		return cached, nil
+	}
+
+	out := req
+	if cached != nil {
+		etag := cached.Header.Get("Etag")
+		modified := cached.Header.Get("Last-Modified")
+		if etag != "" || modified != "" {
+			out = req.Clone(req.Context())
+			if etag != "" {
+				out.Header.Set("If-None-Match", etag)
+			}
+			if modified != "" {
+				out.Header.Set("If-Modified-Since", modified)
+			}
+		}
+	}
+	resp, err := t.transport().RoundTrip(out)
+	if err != nil {
+		if cached != nil {
+			cached.Body.Close()
+		}
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && out != req {
+		resp.Body.Close()
+		t.touch(req)
+		cached.Header.Set(CacheHeader, "revalidated")
+		return cached, nil
+	}
+	if cached != nil {
+		cached.Body.Close()
+	}
+	// challenge pages of Cloudflare may come with a 200
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Cf-Mitigated") != "" {
+		return resp, nil
+	}
+	return t.store(req, resp)
+}
+
+// Clear removes all the cached replies.
+func (t *Transport) Clear() error {
+	files, err := ioutil.ReadDir(t.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(filepath.Join(t.Dir, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package httpcache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// age makes all the cached replies older by d.
+func age(t *testing.T, dir string, d time.Duration) {
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		old := f.ModTime().Add(-d)
+		if err := os.Chtimes(filepath.Join(dir, f.Name()), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var requests, notModified int
+	version := "v1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		case "/plain":
+			w.Write([]byte("plain " + version))
+			return
+		case "/invalid":
+			w.Write([]byte("invalid " + version))
+			return
+		}
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Etag", etag)
+		w.Write([]byte("page " + version))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "httpcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := &Transport{Dir: dir, TTL: map[string]time.Duration{"/": time.Minute, "/plain": time.Hour}}
+	cache.Valid = func(resp *http.Response, body []byte) bool {
+		return !strings.HasPrefix(string(body), "invalid")
+	}
+	hc := &http.Client{Transport: cache}
+
+	get := func(path, expect, header string) {
+		t.Helper()
+		resp, err := hc.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != expect || resp.Header.Get(CacheHeader) != header {
+			t.Errorf("GET %s: expected %q (%q), got %q (%q)", path, expect, header, body, resp.Header.Get(CacheHeader))
+		}
+	}
+
+	get("/page", "page v1", "")
+	get("/page", "page v1", "hit")
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+
+	// stale, revalidated with the etag
+	age(t, dir, 2*time.Minute)
+	get("/page", "page v1", "revalidated")
+	get("/page", "page v1", "hit")
+	if requests != 2 || notModified != 1 {
+		t.Errorf("expected 2 requests with 1 not modified, got %d and %d", requests, notModified)
+	}
+
+	// stale and changed
+	version = "v2"
+	age(t, dir, 2*time.Minute)
+	get("/page", "page v2", "")
+	get("/page", "page v2", "hit")
+
+	// longer TTL for /plain, which has no validators
+	get("/plain", "plain v2", "")
+	age(t, dir, 2*time.Minute)
+	version = "v3"
+	get("/plain", "plain v2", "hit")
+	age(t, dir, 2*time.Hour)
+	get("/plain", "plain v3", "")
+
+	// errors are not cached
+	requests = 0
+	get("/missing", "404 page not found\n", "")
+	get("/missing", "404 page not found\n", "")
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	get("/invalid", "invalid v3", "")
+	get("/invalid", "invalid v3", "")
+	if requests != 4 {
+		t.Errorf("expected 4 requests, got %d", requests)
+	}
+
+	if err := cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	get("/page", "page v3", "")
+}
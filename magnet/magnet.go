@@ -0,0 +1,37 @@
+// Package magnet reads magnet links.
+package magnet
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// Hash returns the lowercase hex info hash of a magnet URI, or "" if uri
+// is not a magnet or has no BitTorrent info hash. Hashes may be given in
+// hex or in base32.
+func Hash(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "magnet" {
+		return ""
+	}
+	for _, xt := range u.Query()["xt"] {
+		if !strings.HasPrefix(strings.ToLower(xt), "urn:btih:") {
+			continue
+		}
+		h := xt[len("urn:btih:"):]
+		switch len(h) {
+		case 40:
+			if _, err := hex.DecodeString(h); err == nil {
+				return strings.ToLower(h)
+			}
+		case 32:
+			// base32 encoded hash
+			if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(h)); err == nil {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+	return ""
+}
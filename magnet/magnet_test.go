@@ -0,0 +1,19 @@
+package magnet
+
+import "testing"
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		uri, expect string
+	}{
+		{"magnet:?xt=urn:btih:0123456789ABCDEF0123456789ABCDEF01234567&dn=Show", "0123456789abcdef0123456789abcdef01234567"},
+		{"magnet:?dn=Show&xt=urn:btih:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH", "0123456789abcdef0123456789abcdef01234567"},
+		{"magnet:?xt=urn:btih:nothex", ""},
+		{"https://example.com/show.torrent", ""},
+	}
+	for _, test := range tests {
+		if got := Hash(test.uri); got != test.expect {
+			t.Errorf("Hash(%q): expected %q, got %q", test.uri, test.expect, got)
+		}
+	}
+}
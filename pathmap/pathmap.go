@@ -0,0 +1,74 @@
+// Package pathmap translates paths between the local library and a
+// torrent client running on another host or in a container, where the
+// same directory is mounted somewhere else.
+package pathmap
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Rule maps the directory Local, as seen by ezupdate, to the directory
+// Remote, as seen by the torrent client.
+type Rule struct {
+	Local  string `yaml:"local"`
+	Remote string `yaml:"remote"`
+}
+
+// Map is a list of rules. When several rules match a path the one with
+// the longest prefix wins.
+type Map []Rule
+
+// ToRemote translates a local path into the path seen by the torrent
+// client. It returns false, and the path unchanged, if no rule matches.
+func (m Map) ToRemote(p string) (string, bool) {
+	best, ok := "", false
+	longest := -1
+	for _, r := range m {
+		if len(r.Local) <= longest {
+			continue
+		}
+		if rest, match := trimPrefix(filepath.Clean(p), filepath.Clean(r.Local), string(filepath.Separator)); match {
+			best, ok, longest = path.Join(r.Remote, filepath.ToSlash(rest)), true, len(r.Local)
+		}
+	}
+	if !ok {
+		return p, false
+	}
+	return best, true
+}
+
+// ToLocal translates a path seen by the torrent client into a local
+// path. It returns false, and the path unchanged, if no rule matches.
+func (m Map) ToLocal(p string) (string, bool) {
+	best, ok := "", false
+	longest := -1
+	for _, r := range m {
+		if len(r.Remote) <= longest {
+			continue
+		}
+		if rest, match := trimPrefix(path.Clean(p), path.Clean(r.Remote), "/"); match {
+			best, ok, longest = filepath.Join(r.Local, filepath.FromSlash(rest)), true, len(r.Remote)
+		}
+	}
+	if !ok {
+		return p, false
+	}
+	return best, true
+}
+
+// trimPrefix removes prefix from p only if it ends on a path component
+// boundary, so that /downloads does not match /downloads2.
+func trimPrefix(p, prefix, sep string) (string, bool) {
+	if p == prefix {
+		return "", true
+	}
+	if !strings.HasSuffix(prefix, sep) {
+		prefix += sep
+	}
+	if strings.HasPrefix(p, prefix) {
+		return p[len(prefix):], true
+	}
+	return p, false
+}
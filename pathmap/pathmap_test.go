@@ -0,0 +1,49 @@
+package pathmap
+
+import "testing"
+
+func TestMap(t *testing.T) {
+	m := Map{
+		{Local: "/mnt/nas/tv", Remote: "/downloads"},
+		{Local: "/mnt/nas/tv/anime", Remote: "/anime"},
+		{Local: "/", Remote: "/root"},
+	}
+	tests := []struct {
+		local, remote string
+	}{
+		{"/mnt/nas/tv", "/downloads"},
+		{"/mnt/nas/tv/", "/downloads"},
+		{"/mnt/nas/tv/Mr Robot/S03", "/downloads/Mr Robot/S03"},
+		{"/mnt/nas/tv/anime/One Piece", "/anime/One Piece"},
+		{"/mnt/nas/tv2/Show", "/root/mnt/nas/tv2/Show"},
+	}
+	for _, test := range tests {
+		remote, ok := m.ToRemote(test.local)
+		if !ok || remote != test.remote {
+			t.Errorf("ToRemote(%q): expected %q, got %q (%v)", test.local, test.remote, remote, ok)
+		}
+		local, ok := m.ToLocal(test.remote)
+		want := test.local
+		if want == "/mnt/nas/tv/" {
+			want = "/mnt/nas/tv"
+		}
+		if !ok || local != want {
+			t.Errorf("ToLocal(%q): expected %q, got %q (%v)", test.remote, want, local, ok)
+		}
+	}
+}
+
+func TestMapNoMatch(t *testing.T) {
+	m := Map{{Local: "/mnt/nas/tv", Remote: "/downloads"}}
+	for _, p := range []string{"/mnt/nas/tv2", "/home/user", "relative/path"} {
+		if got, ok := m.ToRemote(p); ok || got != p {
+			t.Errorf("ToRemote(%q): expected no match, got %q", p, got)
+		}
+	}
+	if got, ok := m.ToLocal("/downloads2/x"); ok || got != "/downloads2/x" {
+		t.Errorf("ToLocal: expected no match, got %q", got)
+	}
+	if got, ok := (Map{}).ToRemote("/x"); ok || got != "/x" {
+		t.Errorf("empty map: expected no match, got %q", got)
+	}
+}
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arcimboldo/tv/eztv"
+)
+
+type eztvProvider struct {
+	name string
+	c    *eztv.Client
+}
+
+// newEztv uses eztv.DefaultClient or, if a URL is given, a client for
+// that URL with the same cache, retries and pace.
+func newEztv(ctx context.Context, cfg Config) (Provider, error) {
+	c := eztv.DefaultClient
+	if cfg.URL != "" {
+		c = c.WithBaseURLs(cfg.URL)
+	}
+	return &eztvProvider{cfg.name(), c}, nil
+}
+
+func (p *eztvProvider) Name() string {
+	return p.name
+}
+
+func (p *eztvProvider) ListShows(ctx context.Context) ([]eztv.Show, error) {
+	shows, err := p.c.ListShows(ctx)
+	for i := range shows {
+		shows[i].Source = p.name
+	}
+	return shows, err
+}
+
+func (p *eztvProvider) GetShow(ctx context.Context, URL string) (eztv.Show, error) {
+	show, err := p.c.GetShow(ctx, URL)
+	if err != nil {
+		return show, err
+	}
+	show.Source = p.name
+	for _, e := range show.Episodes {
+		e.Source = p.name
+	}
+	return show, nil
+}
+
+func (p *eztvProvider) GetShowByImdbID(ctx context.Context, imdbID string) (eztv.Show, error) {
+	show, err := p.c.GetShowByImdbID(ctx, imdbID)
+	if err != nil {
+		return show, err
+	}
+	show.Source = p.name
+	for _, e := range show.Episodes {
+		e.Source = p.name
+	}
+	return show, nil
+}
+
+func (p *eztvProvider) Latest(ctx context.Context, n int) ([]*eztv.Episode, error) {
+	var episodes []*eztv.Episode
+	it := p.c.Releases(ctx, eztv.ReleaseOptions{})
+	for len(episodes) < n && it.Next() {
+		e := it.Release().AsEpisode()
+		e.Source = p.name
+		episodes = append(episodes, &e)
+	}
+	return episodes, it.Err()
+}
+
+// Search gets the show by q.ImdbID from the API or, without an IMDb id,
+// looks for the shows titled q.Title in the show list, and returns their
+// matching episodes.
+func (p *eztvProvider) Search(ctx context.Context, q Query) ([]*eztv.Episode, error) {
+	if q.ImdbID != "" {
+		show, err := p.GetShowByImdbID(ctx, q.ImdbID)
+		if err != nil {
+			return nil, err
+		}
+		var episodes []*eztv.Episode
+		for _, e := range show.Episodes {
+			if q.Match(e) {
+				episodes = append(episodes, e)
+			}
+		}
+		return episodes, nil
+	}
+	if q.Title == "" {
+		return nil, fmt.Errorf("eztv can only search by title or IMDb id")
+	}
+	shows, err := p.c.ListShows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var episodes []*eztv.Episode
+	for _, s := range shows {
+		if !strings.EqualFold(s.Title, q.Title) {
+			continue
+		}
+		show, err := p.GetShow(ctx, s.URL)
+		if err != nil {
+			return episodes, err
+		}
+		for _, e := range show.Episodes {
+			if q.Match(e) {
+				episodes = append(episodes, e)
+			}
+		}
+	}
+	return episodes, nil
+}
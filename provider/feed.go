@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/arcimboldo/tv/eztv"
+	"github.com/arcimboldo/tv/feed"
+	"github.com/arcimboldo/tv/release"
+)
+
+type feedProvider struct {
+	name string
+	url  string
+	hc   *http.Client
+}
+
+func newFeed(ctx context.Context, cfg Config) (Provider, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("rss provider %s needs a url", cfg.name())
+	}
+	return &feedProvider{cfg.name(), cfg.URL, cfg.HTTPClient}, nil
+}
+
+func (p *feedProvider) Name() string {
+	return p.name
+}
+
+func (p *feedProvider) ListShows(ctx context.Context) ([]eztv.Show, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *feedProvider) GetShow(ctx context.Context, URL string) (eztv.Show, error) {
+	return eztv.Show{URL: URL}, ErrNotSupported
+}
+
+// Latest returns the first n items of the feed, which are usually the
+// most recent.
+func (p *feedProvider) Latest(ctx context.Context, n int) ([]*eztv.Episode, error) {
+	episodes, err := p.episodes(ctx)
+	if len(episodes) > n {
+		episodes = episodes[:n]
+	}
+	return episodes, err
+}
+
+// Search returns the items of the feed whose title matches q. Feeds
+// carry no ids, so q.ImdbID and q.TvdbID are ignored.
+func (p *feedProvider) Search(ctx context.Context, q Query) ([]*eztv.Episode, error) {
+	if q.Title == "" {
+		return nil, ErrNotSupported
+	}
+	all, err := p.episodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var episodes []*eztv.Episode
+	for _, e := range all {
+		if SameTitle(e.ShowTitle, q.Title) && q.Match(e) {
+			episodes = append(episodes, e)
+		}
+	}
+	return episodes, nil
+}
+
+// episodes fetches the feed, skipping the items without a download
+// link.
+func (p *feedProvider) episodes(ctx context.Context) ([]*eztv.Episode, error) {
+	items, err := feed.Fetch(ctx, p.hc, p.url)
+	if err != nil {
+		return nil, err
+	}
+	var episodes []*eztv.Episode
+	for _, it := range items {
+		if it.MagnetURL == "" && it.TorrentURL == "" {
+			continue
+		}
+		r := release.Parse(it.Title)
+		e := &eztv.Episode{
+			Title:      it.Title,
+			EpisodeURL: it.Link,
+			TorrentURL: it.TorrentURL,
+			MagnetURL:  it.MagnetURL,
+			ShowTitle:  r.Title,
+			Size:       eztv.FormatSize(it.Size),
+			SizeBytes:  it.Size,
+			Seeds:      it.Seeders,
+			Peers:      -1,
+			Released:   it.Published,
+			Hash:       it.InfoHash,
+			Source:     p.name,
+		}
+		e.SetRelease(r)
+		if !it.Published.IsZero() {
+			e.Release = it.Published.Format("2006-01-02 15:04")
+		}
+		episodes = append(episodes, e)
+	}
+	return episodes, nil
+}
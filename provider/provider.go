@@ -0,0 +1,257 @@
+// Package provider defines a common interface to the indexes of shows
+// and episodes, and adapts the supported indexes to it.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/arcimboldo/tv/eztv"
+)
+
+// ErrNotSupported is returned by providers for the operations they
+// cannot perform, e.g. listing the shows of a search-only indexer.
+var ErrNotSupported = errors.New("operation not supported by the provider")
+
+// Query selects the episodes returned by Search. Zero fields match
+// anything.
+type Query struct {
+	Title   string
+	Season  int
+	Episode int
+	ImdbID  string
+	TvdbID  string
+}
+
+// Match returns true if e is the requested season and episode.
+func (q Query) Match(e *eztv.Episode) bool {
+	return (q.Season == 0 || q.Season == e.Season) && (q.Episode == 0 || q.Episode == e.Episode)
+}
+
+// Provider is an index of shows and episodes. Episodes returned by a
+// provider have their Source set to the provider Name.
+type Provider interface {
+	Name() string
+	// ListShows lists all the shows known to the provider.
+	ListShows(ctx context.Context) ([]eztv.Show, error)
+	// GetShow gets a show, and all its episodes, from its URL.
+	GetShow(ctx context.Context, URL string) (eztv.Show, error)
+	// Latest returns the n latest releases.
+	Latest(ctx context.Context, n int) ([]*eztv.Episode, error)
+	// Search returns the releases matching q.
+	Search(ctx context.Context, q Query) ([]*eztv.Episode, error)
+}
+
+// ImdbGetter is implemented by providers able to get a show from its
+// IMDb id.
+type ImdbGetter interface {
+	GetShowByImdbID(ctx context.Context, imdbID string) (eztv.Show, error)
+}
+
+// Config selects and configures a provider.
+type Config struct {
+	Type string `yaml:"type"`
+	// Name identifies the provider in the output, default is Type.
+	Name string `yaml:"name,omitempty"`
+	URL  string `yaml:"url,omitempty"`
+	// APIKey authenticates to torznab indexers.
+	APIKey string `yaml:"api_key,omitempty"`
+	// Categories restricts torznab searches, e.g. 5000 for TV.
+	Categories []int `yaml:"categories,omitempty"`
+	// HTTPClient is used for all the requests to the provider. If nil
+	// each provider uses its default.
+	HTTPClient *http.Client `yaml:"-"`
+}
+
+func (cfg Config) name() string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return strings.ToLower(cfg.Type)
+}
+
+var providers = map[string]func(context.Context, Config) (Provider, error){
+	"eztv":    newEztv,
+	"torznab": newTorznab,
+	"rss":     newFeed,
+}
+
+// New creates the provider selected by cfg.Type.
+func New(ctx context.Context, cfg Config) (Provider, error) {
+	newProvider, ok := providers[strings.ToLower(cfg.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider type %q, must be one of %v", cfg.Type, Types())
+	}
+	return newProvider(ctx, cfg)
+}
+
+// Types returns the names of the supported providers.
+func Types() []string {
+	var types []string
+	for t := range providers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Set is a list of providers used together.
+type Set []Provider
+
+// NewSet creates a provider for each configuration.
+func NewSet(ctx context.Context, cfgs []Config) (Set, error) {
+	var s Set
+	for _, cfg := range cfgs {
+		p, err := New(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, p)
+	}
+	return s, nil
+}
+
+// errorList collects the errors of the providers.
+type errorList []string
+
+func (l *errorList) add(p Provider, err error) {
+	if err != nil && err != ErrNotSupported {
+		*l = append(*l, fmt.Sprintf("%s: %v", p.Name(), err))
+	}
+}
+
+func (l errorList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(l, "; "))
+}
+
+// ListShows lists the shows of all the providers. An error is returned
+// if any provider fails, together with the shows of the others.
+func (s Set) ListShows(ctx context.Context) ([]eztv.Show, error) {
+	var shows []eztv.Show
+	var errs errorList
+	for _, p := range s {
+		ps, err := p.ListShows(ctx)
+		errs.add(p, err)
+		shows = append(shows, ps...)
+	}
+	return shows, errs.err()
+}
+
+// GetShow gets the show from the first provider able to.
+func (s Set) GetShow(ctx context.Context, URL string) (eztv.Show, error) {
+	var errs errorList
+	for _, p := range s {
+		show, err := p.GetShow(ctx, URL)
+		if err == nil {
+			return show, nil
+		}
+		errs.add(p, err)
+	}
+	if len(errs) == 0 {
+		return eztv.Show{URL: URL}, ErrNotSupported
+	}
+	return eztv.Show{URL: URL}, errs.err()
+}
+
+// GetShowByImdbID gets the show from the first provider able to.
+func (s Set) GetShowByImdbID(ctx context.Context, imdbID string) (eztv.Show, error) {
+	var errs errorList
+	for _, p := range s {
+		g, ok := p.(ImdbGetter)
+		if !ok {
+			continue
+		}
+		show, err := g.GetShowByImdbID(ctx, imdbID)
+		if err == nil {
+			return show, nil
+		}
+		errs.add(p, err)
+	}
+	if len(errs) == 0 {
+		return eztv.Show{ImdbID: imdbID}, ErrNotSupported
+	}
+	return eztv.Show{ImdbID: imdbID}, errs.err()
+}
+
+// Latest returns the n latest releases of each provider.
+func (s Set) Latest(ctx context.Context, n int) ([]*eztv.Episode, error) {
+	var episodes []*eztv.Episode
+	var errs errorList
+	for _, p := range s {
+		eps, err := p.Latest(ctx, n)
+		errs.add(p, err)
+		episodes = append(episodes, eps...)
+	}
+	return episodes, errs.err()
+}
+
+// Search returns the releases matching q from all the providers.
+func (s Set) Search(ctx context.Context, q Query) ([]*eztv.Episode, error) {
+	var episodes []*eztv.Episode
+	var errs errorList
+	for _, p := range s {
+		eps, err := p.Search(ctx, q)
+		errs.add(p, err)
+		episodes = append(episodes, eps...)
+	}
+	return episodes, errs.err()
+}
+
+// SameTitle returns true if the two show titles only differ in case,
+// spacing and punctuation.
+func SameTitle(t1, t2 string) bool {
+	norm := func(s string) string {
+		var b strings.Builder
+		for _, r := range strings.ToLower(s) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	}
+	return norm(t1) == norm(t2)
+}
+
+// sameRelease returns true if the two episodes are the same torrent.
+func sameRelease(e1, e2 *eztv.Episode) bool {
+	if e1.Hash != "" && e2.Hash != "" {
+		return e1.Hash == e2.Hash
+	}
+	return e1.MagnetURL != "" && e1.MagnetURL == e2.MagnetURL
+}
+
+// Complete adds to the show the releases found by the other providers,
+// searching its title and IMDb id. Releases already in the show are
+// skipped. Errors are returned after adding the releases of the
+// providers that did not fail.
+func (s Set) Complete(ctx context.Context, show *eztv.Show) error {
+	var errs errorList
+	for _, p := range s {
+		if p.Name() == show.Source {
+			continue
+		}
+		eps, err := p.Search(ctx, Query{Title: show.Title, ImdbID: show.ImdbID})
+		errs.add(p, err)
+	next:
+		for _, e := range eps {
+			for _, old := range show.Episodes {
+				if sameRelease(e, old) {
+					continue next
+				}
+			}
+			e.ShowTitle = show.Title
+			e.ShowURL = show.URL
+			show.Episodes = append(show.Episodes, e)
+		}
+	}
+	show.SortEpisodes()
+	return errs.err()
+}
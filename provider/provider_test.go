@@ -0,0 +1,238 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arcimboldo/tv/eztv"
+)
+
+// fake is a provider serving a fixed list of episodes, and no show page.
+type fake struct {
+	name     string
+	episodes []*eztv.Episode
+	err      error
+}
+
+func (f *fake) Name() string { return f.name }
+
+func (f *fake) ListShows(ctx context.Context) ([]eztv.Show, error) {
+	return nil, ErrNotSupported
+}
+
+func (f *fake) GetShow(ctx context.Context, URL string) (eztv.Show, error) {
+	return eztv.Show{}, ErrNotSupported
+}
+
+func (f *fake) Latest(ctx context.Context, n int) ([]*eztv.Episode, error) {
+	return f.episodes, f.err
+}
+
+func (f *fake) Search(ctx context.Context, q Query) ([]*eztv.Episode, error) {
+	var eps []*eztv.Episode
+	for _, e := range f.episodes {
+		if q.Match(e) {
+			c := *e
+			c.Source = f.name
+			eps = append(eps, &c)
+		}
+	}
+	return eps, f.err
+}
+
+func TestNewUnknownType(t *testing.T) {
+	if _, err := New(context.Background(), Config{Type: "nosuch"}); err == nil {
+		t.Errorf("expected error for an unknown provider")
+	}
+}
+
+func TestGetShow(t *testing.T) {
+	ctx := context.Background()
+	s := Set{&fake{name: "a"}, &fake{name: "b"}}
+	if _, err := s.GetShow(ctx, "https://example.com/show"); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	s = append(s, &fake{name: "broken", err: errors.New("down")})
+	if _, err := s.Latest(ctx, 5); err == nil || err.Error() != "broken: down" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	show := &eztv.Show{
+		Title:  "Mr Robot",
+		URL:    "https://eztv.ag/shows/1/mr-robot/",
+		Source: "eztv",
+		Episodes: []*eztv.Episode{
+			{Season: 3, Episode: 2, Hash: "2222", Source: "eztv"},
+			{Season: 3, Episode: 3, Hash: "3333", Source: "eztv"},
+		},
+	}
+	s := Set{
+		&fake{name: "eztv", episodes: []*eztv.Episode{{Season: 3, Episode: 4, Hash: "4444"}}},
+		&fake{name: "other", episodes: []*eztv.Episode{
+			{Season: 3, Episode: 1, Hash: "1111"},
+			{Season: 3, Episode: 2, Hash: "2222"},
+			{Season: 3, Episode: 2, MagnetURL: "magnet:?xt=urn:btih:aaaa"},
+		}},
+		&fake{name: "broken", err: errors.New("down")},
+	}
+	if err := s.Complete(context.Background(), show); err == nil {
+		t.Errorf("expected error from the broken provider")
+	}
+	var got []string
+	for _, e := range show.Episodes {
+		got = append(got, e.Source+":"+e.Hash+e.MagnetURL)
+		if e.ShowTitle != "" && e.ShowTitle != show.Title {
+			t.Errorf("unexpected show title %q", e.ShowTitle)
+		}
+	}
+	expect := []string{"other:1111", "eztv:2222", "other:magnet:?xt=urn:btih:aaaa", "eztv:3333"}
+	if len(got) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, got)
+	}
+	for i := range got {
+		if got[i] != expect[i] {
+			t.Errorf("expected %v, got %v", expect, got)
+			break
+		}
+	}
+}
+
+const torznabCaps = `<caps>
+  <searching>
+    <search available="yes" supportedParams="q" />
+    <tv-search available="yes" supportedParams="q,season,ep,imdbid,tvdbid" />
+  </searching>
+</caps>`
+
+const torznabResults = `<rss version="1.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+  <channel>
+    <item>
+      <title>Mr.Robot.S03E01.1080p.WEB-DL.DD5.1.H264-GRP</title>
+      <size>2147483648</size>
+      <torznab:attr name="seeders" value="42" />
+      <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA" />
+    </item>
+    <item>
+      <title>Mr Robot S03E01 720p HDTV x264-KILLERS</title>
+      <link>magnet:?xt=urn:btih:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb</link>
+      <torznab:attr name="season" value="3" />
+      <torznab:attr name="episode" value="1" />
+    </item>
+  </channel>
+</rss>`
+
+// fakeTorznab serves the caps and the results of an indexer, or errors
+// while up is false.
+func fakeTorznab(up *bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case !*up:
+			http.Error(w, "indexer down", http.StatusBadGateway)
+		case r.URL.Query().Get("t") == "caps":
+			w.Write([]byte(torznabCaps))
+		default:
+			w.Write([]byte(torznabResults))
+		}
+	}))
+}
+
+func TestTorznabSearch(t *testing.T) {
+	up := true
+	srv := fakeTorznab(&up)
+	defer srv.Close()
+
+	ctx := context.Background()
+	p, err := New(ctx, Config{Type: "torznab", Name: "jackett", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps, err := p.Search(ctx, Query{Title: "Mr. Robot", Season: 3, Episode: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 2 {
+		t.Fatalf("expected 2 episodes, got %d", len(eps))
+	}
+	e := eps[0]
+	if e.ShowTitle != "Mr Robot" || e.Season != 3 || e.Episode != 1 || e.Seeds != 42 || e.SizeBytes != 2147483648 || e.Size != "2.00 GB" || e.Source != "jackett" {
+		t.Errorf("unexpected episode %+v", e)
+	}
+	if eps, _ := p.Search(ctx, Query{Title: "Mr Robot", Season: 2}); len(eps) != 0 {
+		t.Errorf("expected no episodes of season 2, got %d", len(eps))
+	}
+	if eps, _ := p.Search(ctx, Query{Title: "Robot Wars"}); len(eps) != 0 {
+		t.Errorf("expected no episodes of another show, got %d", len(eps))
+	}
+}
+
+func TestTorznabCapsLater(t *testing.T) {
+	up := false
+	srv := fakeTorznab(&up)
+	defer srv.Close()
+
+	// an unreachable indexer does not prevent creating the provider
+	ctx := context.Background()
+	p, err := New(ctx, Config{Type: "torznab", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Search(ctx, Query{Title: "Mr. Robot"}); err == nil {
+		t.Errorf("expected error while the indexer is down")
+	}
+	up = true
+	if eps, err := p.Search(ctx, Query{Title: "Mr. Robot"}); err != nil || len(eps) == 0 {
+		t.Errorf("expected episodes once the indexer is up, got %d (%v)", len(eps), err)
+	}
+}
+
+const rssFeed = `<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">
+  <channel>
+    <item>
+      <title>Mr.Robot.S03E02.1080p.WEB-DL.DD5.1.H264-GRP</title>
+      <enclosure url="https://tracker.example/download/2002/Mr.Robot.S03E02.torrent" type="application/x-bittorrent" />
+    </item>
+    <item>
+      <title>Mr Robot S03E01 720p HDTV x264-KILLERS</title>
+      <torrent:infoHash>BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB</torrent:infoHash>
+      <torrent:magnetURI>magnet:?xt=urn:btih:BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB</torrent:magnetURI>
+    </item>
+    <item>
+      <title>[Group] Some Anime - 05 [1080p].mkv</title>
+      <link>https://nyaa.example/download/3003.torrent</link>
+    </item>
+  </channel>
+</rss>`
+
+func TestFeedSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rssFeed))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	p, err := New(ctx, Config{Type: "rss", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps, err := p.Search(ctx, Query{Title: "Mr Robot", Season: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 2 {
+		t.Fatalf("expected 2 episodes, got %d", len(eps))
+	}
+	if e := eps[0]; e.Episode != 2 || e.DownloadURL() == "" || e.MagnetURL != "" || e.Source != "rss" {
+		t.Errorf("unexpected episode %+v", e)
+	}
+	if e := eps[1]; e.Episode != 1 || e.Hash != "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" {
+		t.Errorf("unexpected episode %+v", e)
+	}
+	if latest, err := p.Latest(ctx, 1); err != nil || len(latest) != 1 {
+		t.Errorf("expected 1 episode, got %d (%v)", len(latest), err)
+	}
+}
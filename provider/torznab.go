@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/arcimboldo/tv/eztv"
+	"github.com/arcimboldo/tv/release"
+	"github.com/arcimboldo/tv/torznab"
+)
+
+type torznabProvider struct {
+	name       string
+	c          *torznab.Client
+	categories []int
+
+	mu   sync.Mutex
+	caps *torznab.Caps
+}
+
+func newTorznab(ctx context.Context, cfg Config) (Provider, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("torznab provider %s needs a url", cfg.name())
+	}
+	c := torznab.NewClient(cfg.HTTPClient, cfg.URL, cfg.APIKey)
+	return &torznabProvider{name: cfg.name(), c: c, categories: cfg.Categories}, nil
+}
+
+// capabilities fetches the capabilities of the indexer on the first
+// search, to only send the search parameters it supports. An unreachable
+// indexer only fails its own searches, and is asked again the next time.
+func (p *torznabProvider) capabilities(ctx context.Context) (torznab.Caps, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.caps == nil {
+		caps, err := p.c.Caps(ctx)
+		if err != nil {
+			return caps, err
+		}
+		p.caps = &caps
+	}
+	return *p.caps, nil
+}
+
+func (p *torznabProvider) Name() string {
+	return p.name
+}
+
+func (p *torznabProvider) ListShows(ctx context.Context) ([]eztv.Show, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *torznabProvider) GetShow(ctx context.Context, URL string) (eztv.Show, error) {
+	return eztv.Show{URL: URL}, ErrNotSupported
+}
+
+func (p *torznabProvider) Latest(ctx context.Context, n int) ([]*eztv.Episode, error) {
+	items, err := p.c.TVSearch(ctx, torznab.TVQuery{Categories: p.categories, Limit: n})
+	if err != nil {
+		return nil, err
+	}
+	var episodes []*eztv.Episode
+	for _, it := range items {
+		episodes = append(episodes, p.episode(it))
+	}
+	return episodes, nil
+}
+
+func (p *torznabProvider) Search(ctx context.Context, q Query) ([]*eztv.Episode, error) {
+	caps, err := p.capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var items []torznab.Item
+	tv := caps.TVSearch
+	switch {
+	case tv.Available == "yes":
+		tq := torznab.TVQuery{Categories: p.categories}
+		if tv.Supports("imdbid") && q.ImdbID != "" {
+			tq.ImdbID = q.ImdbID
+		} else if tv.Supports("tvdbid") && q.TvdbID != "" {
+			tq.TvdbID = q.TvdbID
+		} else if tv.Supports("q") && q.Title != "" {
+			tq.Query = q.Title
+		} else {
+			return nil, fmt.Errorf("no search parameter supported by %s in %+v", p.name, q)
+		}
+		if tv.Supports("season") {
+			tq.Season = q.Season
+		}
+		if tv.Supports("ep") {
+			tq.Episode = q.Episode
+		}
+		items, err = p.c.TVSearch(ctx, tq)
+	case caps.Search.Supports("q") && q.Title != "":
+		query := q.Title
+		if q.Season > 0 && q.Episode > 0 {
+			query += fmt.Sprintf(" S%02dE%02d", q.Season, q.Episode)
+		}
+		items, err = p.c.Search(ctx, query, p.categories...)
+	default:
+		return nil, ErrNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// indexers match loosely, results for other shows are dropped
+	var episodes []*eztv.Episode
+	for _, it := range items {
+		e := p.episode(it)
+		if !q.Match(e) {
+			continue
+		}
+		if q.ImdbID != "" && it.ImdbID != "" {
+			if eztv.NormImdbID(it.ImdbID) != eztv.NormImdbID(q.ImdbID) {
+				continue
+			}
+		} else if q.Title != "" && !SameTitle(e.ShowTitle, q.Title) {
+			continue
+		}
+		episodes = append(episodes, e)
+	}
+	return episodes, nil
+}
+
+// episode converts a search result. Season and episode are parsed from
+// the title when the indexer does not give them.
+func (p *torznabProvider) episode(it torznab.Item) *eztv.Episode {
+	r := release.Parse(it.Title)
+	e := &eztv.Episode{
+		Title:      it.Title,
+		EpisodeURL: it.Comments,
+		TorrentURL: it.TorrentURL(),
+		MagnetURL:  it.Magnet(),
+		ShowTitle:  r.Title,
+		Size:       eztv.FormatSize(it.Size),
+		SizeBytes:  it.Size,
+		Seeds:      it.Seeders,
+		Peers:      it.Peers,
+		Released:   it.PubDate,
+		Hash:       it.InfoHash,
+		Source:     p.name,
+	}
+	e.SetRelease(r)
+	if it.Season >= 0 && it.Episode >= 0 && e.AirDate.IsZero() {
+		e.Season, e.Episode = it.Season, it.Episode
+	}
+	if !it.PubDate.IsZero() {
+		e.Release = it.PubDate.Format("2006-01-02 15:04")
+	}
+	return e
+}
@@ -0,0 +1,239 @@
+// Package qbittorrent is a client for the qBittorrent WebUI API v2.
+package qbittorrent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	URL    string
+	user   string
+	pwd    string
+	client *http.Client
+}
+
+// Torrent is an entry of torrents/info.
+type Torrent struct {
+	Hash     string  `json:"hash"`
+	Name     string  `json:"name"`
+	State    string  `json:"state"`
+	Progress float64 `json:"progress"`
+	SavePath string  `json:"save_path"`
+	Size     int64   `json:"size"`
+	DlSpeed  int64   `json:"dlspeed"`
+	UpSpeed  int64   `json:"upspeed"`
+	Eta      int64   `json:"eta"`
+	NumSeeds int     `json:"num_seeds"`
+	NumLeech int     `json:"num_leechs"`
+	Category string  `json:"category"`
+	Tags     string  `json:"tags"`
+}
+
+// AddOptions are the arguments of torrents/add.
+type AddOptions struct {
+	URLs     []string // magnet or torrent URLs
+	SavePath string
+	Category string
+	Tags     []string
+	Paused   bool
+}
+
+// DefaultHTTPClient is used when NewClient is given a nil *http.Client.
+var DefaultHTTPClient = &http.Client{Timeout: time.Minute}
+
+// NewClient logs in to the qBittorrent WebUI at URL using a copy of hc,
+// or of DefaultHTTPClient if hc is nil, with its own cookie jar.
+func NewClient(ctx context.Context, hc *http.Client, URL, user, password string) (*Client, error) {
+	if hc == nil {
+		hc = DefaultHTTPClient
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *hc
+	client.Jar = jar
+	c := &Client{URL: strings.TrimRight(URL, "/"), user: user, pwd: password, client: &client}
+	return c, c.Login(ctx)
+}
+
+// Login gets a new session cookie.
+func (c *Client) Login(ctx context.Context) error {
+	resp, err := c.postForm(ctx, "/api/v2/auth/login", url.Values{"username": {c.user}, "password": {c.pwd}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || strings.TrimSpace(string(body)) != "Ok." {
+		return fmt.Errorf("unable to login to qBittorrent. Server replied %d (%v) %q", resp.StatusCode, resp.Status, body)
+	}
+	return nil
+}
+
+func (c *Client) postForm(ctx context.Context, path string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// qBittorrent refuses requests whose Referer does not match its host
+	req.Header.Set("Referer", c.URL)
+	return c.client.Do(req)
+}
+
+// call posts the form to the API method. When the session has expired
+// the server replies 403 Forbidden: the client logs in again and
+// retries once. The reply body is returned.
+func (c *Client) call(ctx context.Context, method string, form url.Values) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.postForm(ctx, "/api/v2/"+method, form)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusForbidden && attempt == 0 {
+			if err := c.Login(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != 200 {
+			return body, &StatusError{method, resp.StatusCode, resp.Status}
+		}
+		return body, nil
+	}
+}
+
+// StatusError is returned when the API replies with an unexpected HTTP
+// status.
+type StatusError struct {
+	Method string
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("got error %d (%s) while calling %s", e.Code, e.Status, e.Method)
+}
+
+// AddTorrent adds the torrents. qBittorrent does not return the hash of
+// the added torrents.
+func (c *Client) AddTorrent(ctx context.Context, opts AddOptions) error {
+	if len(opts.URLs) == 0 {
+		return fmt.Errorf("no torrent URL given")
+	}
+	form := url.Values{"urls": {strings.Join(opts.URLs, "\n")}}
+	if opts.SavePath != "" {
+		form.Set("savepath", opts.SavePath)
+	}
+	if opts.Category != "" {
+		form.Set("category", opts.Category)
+	}
+	if len(opts.Tags) > 0 {
+		var tags []string
+		for _, tag := range opts.Tags {
+			tags = append(tags, TagName(tag))
+		}
+		form.Set("tags", strings.Join(tags, ","))
+	}
+	if opts.Paused {
+		// "paused" up to qBittorrent 4, "stopped" since 5
+		form.Set("paused", "true")
+		form.Set("stopped", "true")
+	}
+	body, err := c.call(ctx, "torrents/add", form)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != "Ok." {
+		return fmt.Errorf("unable to add torrent: %q", body)
+	}
+	return nil
+}
+
+// TagName converts s into a valid tag name. Tags are separated by commas,
+// so commas are replaced by spaces: "Love, Death & Robots" becomes "Love
+// Death & Robots".
+func TagName(s string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(s, ",", " ")), " ")
+}
+
+// Torrents returns the torrents with the given hashes, or all of them
+// if no hash is given, optionally filtered by category.
+func (c *Client) Torrents(ctx context.Context, category string, hashes ...string) ([]Torrent, error) {
+	form := url.Values{}
+	if category != "" {
+		form.Set("category", category)
+	}
+	if len(hashes) > 0 {
+		form.Set("hashes", strings.Join(hashes, "|"))
+	}
+	body, err := c.call(ctx, "torrents/info", form)
+	if err != nil {
+		return nil, err
+	}
+	var torrents []Torrent
+	if err := json.Unmarshal(body, &torrents); err != nil {
+		return nil, fmt.Errorf("invalid reply to torrents/info: %v", err)
+	}
+	return torrents, nil
+}
+
+// hashesCall runs a method taking a list of hashes, refusing an empty
+// list.
+func (c *Client) hashesCall(ctx context.Context, method string, form url.Values, hashes []string) error {
+	if len(hashes) == 0 {
+		return fmt.Errorf("%s: no torrent hashes given", method)
+	}
+	form.Set("hashes", strings.Join(hashes, "|"))
+	_, err := c.call(ctx, method, form)
+	return err
+}
+
+// Delete removes the torrents, and their files if deleteFiles is true.
+func (c *Client) Delete(ctx context.Context, deleteFiles bool, hashes ...string) error {
+	return c.hashesCall(ctx, "torrents/delete", url.Values{"deleteFiles": {fmt.Sprint(deleteFiles)}}, hashes)
+}
+
+// Pause pauses the torrents.
+func (c *Client) Pause(ctx context.Context, hashes ...string) error {
+	return c.renamedCall(ctx, "torrents/pause", "torrents/stop", hashes)
+}
+
+// Resume resumes the torrents.
+func (c *Client) Resume(ctx context.Context, hashes ...string) error {
+	return c.renamedCall(ctx, "torrents/resume", "torrents/start", hashes)
+}
+
+// renamedCall runs method, falling back to newName on servers that
+// renamed it (qBittorrent 5 renamed pause/resume to stop/start).
+func (c *Client) renamedCall(ctx context.Context, method, newName string, hashes []string) error {
+	err := c.hashesCall(ctx, method, url.Values{}, hashes)
+	if se, ok := err.(*StatusError); ok && se.Code == http.StatusNotFound {
+		return c.hashesCall(ctx, newName, url.Values{}, hashes)
+	}
+	return err
+}
+
+// SetLocation moves the data of the torrents to location.
+func (c *Client) SetLocation(ctx context.Context, location string, hashes ...string) error {
+	return c.hashesCall(ctx, "torrents/setLocation", url.Values{"location": {location}}, hashes)
+}
+
+// Reannounce asks the trackers for more peers.
+func (c *Client) Reannounce(ctx context.Context, hashes ...string) error {
+	return c.hashesCall(ctx, "torrents/reannounce", url.Values{}, hashes)
+}
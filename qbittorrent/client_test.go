@@ -0,0 +1,191 @@
+package qbittorrent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// fake is a qBittorrent WebUI stand-in. It hands out the session cookie
+// "sid" on login and refuses other requests without it.
+type fake struct {
+	*httptest.Server
+	mu       sync.Mutex
+	session  string
+	logins   int
+	torrents []Torrent
+	calls    map[string]url.Values
+	v5       bool // pause and resume renamed stop and start
+}
+
+func fakeServer(t *testing.T) *fake {
+	f := &fake{session: "sid", calls: make(map[string]url.Values)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.URL.Path == "/api/v2/auth/login" {
+			f.logins++
+			if r.PostForm.Get("username") != "admin" || r.PostForm.Get("password") != "pwd" {
+				w.Write([]byte("Fails."))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: f.session, Path: "/"})
+			w.Write([]byte("Ok."))
+			return
+		}
+		if c, err := r.Cookie("SID"); err != nil || c.Value != f.session {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		method := r.URL.Path[len("/api/v2/"):]
+		f.calls[method] = r.PostForm
+		switch method {
+		case "torrents/add":
+			w.Write([]byte("Ok."))
+		case "torrents/info":
+			json.NewEncoder(w).Encode(f.torrents)
+		case "torrents/pause", "torrents/resume":
+			if f.v5 {
+				http.NotFound(w, r)
+			}
+		case "torrents/delete", "torrents/stop", "torrents/start", "torrents/setLocation", "torrents/reannounce":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return f
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+
+	if _, err := NewClient(ctx, nil, srv.URL, "admin", "wrong"); err == nil {
+		t.Errorf("expected login error with a wrong password")
+	}
+	c, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expire the session: the client must log in again transparently
+	srv.mu.Lock()
+	srv.session = "sid2"
+	logins := srv.logins
+	srv.mu.Unlock()
+	if _, err := c.Torrents(ctx, ""); err != nil {
+		t.Fatalf("expected call to succeed after session expired, got %v", err)
+	}
+	if srv.logins != logins+1 {
+		t.Errorf("expected one more login, got %d", srv.logins-logins)
+	}
+}
+
+func TestAddTorrent(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddTorrent(ctx, AddOptions{
+		URLs:     []string{"magnet:?xt=urn:btih:abcd"},
+		SavePath: "/downloads/Show/S01",
+		Category: "tv",
+		Tags:     []string{"tv/Love, Death & Robots", "auto"},
+		Paused:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := srv.calls["torrents/add"]
+	expect := map[string]string{
+		"urls":     "magnet:?xt=urn:btih:abcd",
+		"savepath": "/downloads/Show/S01",
+		"category": "tv",
+		"tags":     "tv/Love Death & Robots,auto",
+		"paused":   "true",
+	}
+	for k, v := range expect {
+		if form.Get(k) != v {
+			t.Errorf("expected %s=%q, got %q", k, v, form.Get(k))
+		}
+	}
+
+	if err := c.AddTorrent(ctx, AddOptions{}); err == nil {
+		t.Errorf("expected error without URLs")
+	}
+}
+
+func TestTorrents(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+	srv.torrents = []Torrent{{Hash: "abcd", Name: "Show.S01E01", State: "downloading", Progress: 0.25, SavePath: "/downloads"}}
+	c, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrents, err := c.Torrents(ctx, "tv", "abcd", "ef01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 || torrents[0].Hash != "abcd" || torrents[0].Progress != 0.25 {
+		t.Errorf("unexpected torrents %+v", torrents)
+	}
+	form := srv.calls["torrents/info"]
+	if form.Get("hashes") != "abcd|ef01" || form.Get("category") != "tv" {
+		t.Errorf("unexpected torrents/info arguments %v", form)
+	}
+}
+
+func TestTorrentActions(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t)
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete(ctx, true, "abcd", "ef01"); err != nil {
+		t.Fatal(err)
+	}
+	if form := srv.calls["torrents/delete"]; form.Get("hashes") != "abcd|ef01" || form.Get("deleteFiles") != "true" {
+		t.Errorf("unexpected torrents/delete arguments %v", form)
+	}
+	if err := c.SetLocation(ctx, "/new", "abcd"); err != nil {
+		t.Fatal(err)
+	}
+	if form := srv.calls["torrents/setLocation"]; form.Get("location") != "/new" {
+		t.Errorf("unexpected torrents/setLocation arguments %v", form)
+	}
+	if err := c.Pause(ctx, "abcd"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.calls["torrents/pause"]; !ok {
+		t.Errorf("expected torrents/pause to be called")
+	}
+
+	srv.v5 = true
+	if err := c.Resume(ctx, "abcd"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.calls["torrents/start"]; !ok {
+		t.Errorf("expected fallback to torrents/start")
+	}
+
+	if err := c.Delete(ctx, false); err == nil {
+		t.Errorf("expected error without hashes")
+	}
+}
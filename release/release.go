@@ -0,0 +1,406 @@
+// Package release parses the names of scene and P2P releases, like
+// "Show.Name.S01E02.1080p.WEB-DL.DDP5.1.H.264-GRP", into the show, the
+// episode and the properties of the release.
+package release
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Info is what the name of a release tells about it. Strings are empty,
+// and flags false, when the name does not mention them. Values are
+// normalized, e.g. "h.265" and "HEVC" are both "x265".
+type Info struct {
+	// Title is the name of the show. It is the whole name when the
+	// name has no episode number.
+	Title string
+	// Season and Episode are -1 if the name has no episode number. Daily
+	// releases, like "Show.2024.03.11", have the year as season and
+	// month*100+day as episode, e.g. 2024 and 311, so that they sort by
+	// date. Releases numbered from the first episode of the show, like
+	// "[Group] Show - 1071", are episodes of season 1.
+	Season  int
+	Episode int
+	// Episodes are the episodes of multi-episode releases, e.g. 1, 2, 3
+	// for S01E01-E03, and nil for the other releases
+	Episodes []int
+	// AirDate is the date of daily releases
+	AirDate time.Time
+	// Absolute is the number of the episode counting from the first one
+	// of the show, for releases numbered that way
+	Absolute int
+	// Pack is true for season packs, like "Show.S03.1080p" or "Show
+	// Season 3 Complete", which have Season set and Episode -1. Parts of
+	// seasons, like "Show S03 Part 1", are not packs.
+	Pack bool
+	// Seasons are the seasons of packs of several seasons, e.g. 1, 2, 3
+	// for S01-S03, whose Season is the first one, and nil for the other
+	// releases
+	Seasons []int
+
+	Resolution string // 2160p, 1080p, 1080i, 720p, 576p, 480p
+	Source     string // WEB-DL, WEBRip, WEB, HDTV, SDTV, BluRay, DVD
+	Codec      string // x264, x265, AV1, VP9, XviD
+	// Audio is the codec and, if given, the channels, e.g. DDP5.1, AAC2.0,
+	// DTS-HD MA, TrueHD
+	Audio string
+	Atmos bool
+	HDR   bool // any of HDR, HDR10, HDR10+
+	DV    bool // Dolby Vision
+
+	Proper   bool
+	Repack   bool // also for RERIP
+	Internal bool
+	// Edition is e.g. Extended, Director's Cut, Uncut, Remastered
+	Edition string
+	// Group is the release group, e.g. NTb in "...x264-NTb"
+	Group string
+}
+
+// Quality returns the resolution, source and codec of the release, and
+// its HDR and Dolby Vision flags, e.g. "2160p WEB-DL x265 HDR DV".
+func (i Info) Quality() string {
+	var q []string
+	for _, s := range []string{i.Resolution, i.Source, i.Codec} {
+		if s != "" {
+			q = append(q, s)
+		}
+	}
+	if i.HDR {
+		q = append(q, "HDR")
+	}
+	if i.DV {
+		q = append(q, "DV")
+	}
+	return strings.Join(q, " ")
+}
+
+// tag is a word of a release name and its normalized value.
+type tag struct {
+	re    *regexp.Regexp
+	value string
+}
+
+// sep is what separates the words of a release name.
+const sep = `[\s._\-\[\](),+]`
+
+// word matches re as a whole word of a release name. The first submatch
+// of the regexp is the first submatch of re.
+func word(re string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|` + sep + `)(?:` + re + `)(?:$|` + sep + `)`)
+}
+
+func tags(pairs ...string) []tag {
+	var t []tag
+	for i := 0; i+1 < len(pairs); i += 2 {
+		t = append(t, tag{word(pairs[i]), pairs[i+1]})
+	}
+	return t
+}
+
+// audioTags returns the tags of audio codecs, optionally followed by the
+// channels, e.g. "DDP5.1", "AAC 2.0" or "DD.5.1".
+func audioTags(pairs ...string) []tag {
+	for i := 0; i < len(pairs); i += 2 {
+		pairs[i] = `(?:` + pairs[i] + `)(?:[\s.]?([1-7])[\s.]([01]))?`
+	}
+	return tags(pairs...)
+}
+
+// The tags are tried in order and the first match wins.
+var (
+	resolutions = tags(
+		`2160p|4k|uhd`, "2160p",
+		`1080p|fhd`, "1080p",
+		`1080i`, "1080i",
+		`720p`, "720p",
+		`576[pi]`, "576p",
+		`480[pi]`, "480p",
+	)
+	sources = tags(
+		`web[\s._-]?dl`, "WEB-DL",
+		`web[\s._-]?rip`, "WEBRip",
+		`web`, "WEB",
+		`hdtv(?:rip)?`, "HDTV",
+		`pdtv|sdtv|dsr(?:ip)?|tv[\s._-]?rip`, "SDTV",
+		`blu[\s._-]?ray|bd[\s._-]?rip|br[\s._-]?rip|bd[\s._-]?remux|bdmv`, "BluRay",
+		`dvd[\s._-]?rip|dvd(?:r|5|9)?`, "DVD",
+	)
+	codecs = tags(
+		`[xh][\s.]?265|hevc`, "x265",
+		`[xh][\s.]?264|avc`, "x264",
+		`av1`, "AV1",
+		`vp9`, "VP9",
+		`xvid|divx`, "XviD",
+	)
+	audios = audioTags(
+		`ddp|dd\+|e-?ac-?3`, "DDP",
+		`truehd`, "TrueHD",
+		`dts[\s._-]?hd[\s._-]?ma`, "DTS-HD MA",
+		`dts[\s._-]?hd`, "DTS-HD",
+		`dts[\s._-]?x`, "DTS-X",
+		`dts`, "DTS",
+		`dd|ac-?3`, "DD",
+		`aac`, "AAC",
+		`flac`, "FLAC",
+		`opus`, "Opus",
+		`mp3`, "MP3",
+	)
+	editions = tags(
+		`extended(?:[\s._-](?:cut|edition))?`, "Extended",
+		`director'?s[\s._-]cut`, "Director's Cut",
+		`uncut`, "Uncut",
+		`unrated`, "Unrated",
+		`theatrical(?:[\s._-]cut)?`, "Theatrical",
+		`remastered`, "Remastered",
+		`imax`, "IMAX",
+		`criterion`, "Criterion",
+	)
+
+	atmosRE    = word(`atmos`)
+	hdrRE      = word(`hdr(?:10(?:\+|plus)?)?`)
+	dvRE       = word(`dv|dovi|dolby[\s._-]?vision`)
+	properRE   = word(`proper`)
+	repackRE   = word(`repack[0-9]?|rerip`)
+	internalRE = word(`internal`)
+
+	titleRE = regexp.MustCompile(`(?i)^(.*?)[\s._-]*\bS?([0-9]+)[Ex]([0-9]+)`)
+	// moreRE matches the next episode of multi-episode releases, e.g.
+	// "E02" in S01E01E02, and the last one of ranges, e.g. "-E03" or "-03"
+	// in S01E01-E03
+	moreRE = regexp.MustCompile(`(?i)^(?:[\s._]?E|[\s._]?(-)[\s._]?(E|[0-9]+x|S[0-9]+E)?)([0-9]{1,3})(?:$|[^0-9a-z])`)
+	// packRE matches season packs, e.g. "S03", "Complete Season 3", and
+	// ranges of seasons, e.g. "S01-S03" or "Season 1-3"
+	packRE = regexp.MustCompile(`(?i)^(.*?)[\s._-]*(?:\bcomplete[\s._-]*)?\b(?:S|Season[\s._-]?)([0-9]{1,2})(?:[\s._]*-[\s._]*(?:S|Season[\s._-]?)([0-9]{1,2})|-([0-9]{1,2}))?\b`)
+	// partRE matches what follows the season of a release that is not
+	// a whole season, e.g. " Part 1" or " - 05"
+	partRE  = regexp.MustCompile(`(?i)^[\s._]*(?:-[\s._]*[0-9]{1,4}(?:v[0-9])?(?:$|[^0-9a-z])|(?:part|pt|vol(?:ume)?|ep(?:isode)?|e|dis[ck]|cd)[\s._-]?[0-9]+\b)`)
+	dailyRE = regexp.MustCompile(`^(.*?)[\s._-]*\b((?:19|20)[0-9]{2})[\s._-](0[1-9]|1[0-2])[\s._-](0[1-9]|[12][0-9]|3[01])\b`)
+	// absoluteRE matches the names of anime releases, e.g.
+	// "[Group] Show - 1071 (1080p)" or "Show - 05v2 [720p]"
+	absoluteRE = regexp.MustCompile(`^(.*?)[\s_]+-[\s_]+([0-9]{1,4})(?:v[0-9])?(?:$|[\s._\[\](])`)
+	// animeSeasonRE matches the season ending the title of anime
+	// releases numbered in their season, e.g. "[Group] Show S2 - 05"
+	animeSeasonRE = regexp.MustCompile(`(?i)[\s._-]+(?:S|Season[\s._-]?)([0-9]{1,2})$`)
+	// leadingGroupRE matches the group of anime releases, given first
+	leadingGroupRE = regexp.MustCompile(`^\[([^\]]+)\][\s._]*`)
+	// extensions and tags of the sites appended to the names of the
+	// releases, e.g. "[eztv]" or " EZTV", which hide the group
+	extRE   = regexp.MustCompile(`(?i)\.(mkv|avi|mp4|m4v|mov|wmv|ts|torrent)$`)
+	siteRE  = regexp.MustCompile(`(?i)(?:\s*\[[^\]]*\]|\s+eztv|\s+rartv|\s+rarbg)+\s*$`)
+	groupRE = regexp.MustCompile(`-([a-zA-Z0-9]+)$`)
+	// groupRE matches the end of these words too
+	notGroups = map[string]bool{"dl": true, "hd": true, "rip": true, "ma": true, "x": true}
+)
+
+// find returns the value of the first tag matching s, and the
+// submatches.
+func find(s string, tags []tag) (string, []string) {
+	for _, t := range tags {
+		if m := t.re.FindStringSubmatch(s); m != nil {
+			return t.value, m
+		}
+	}
+	return "", nil
+}
+
+// Codec returns the normalized name of the video codec name, e.g. "x265"
+// for "HEVC" or "h.265", or "" if it is not a known codec.
+func Codec(name string) string {
+	c, _ := find(name, codecs)
+	return c
+}
+
+// Parse parses the name of a release. Properties are only looked for
+// after the episode number, so that shows like "Dark Web" are not taken
+// for WEB releases.
+func Parse(name string) Info {
+	i := Info{Title: name, Season: -1, Episode: -1}
+	var group string
+	body := name
+	if m := leadingGroupRE.FindStringSubmatch(name); m != nil {
+		group, body = m[1], name[len(m[0]):]
+	}
+	rest := name
+	if r, ok := i.parseEpisode(body); ok {
+		rest = r
+	} else if r, ok := i.parsePack(body); ok {
+		rest = r
+	} else if r, ok := i.parseDaily(body); ok {
+		rest = r
+	} else if r, ok := i.parseAbsolute(body); ok {
+		rest = r
+	}
+
+	i.Resolution, _ = find(rest, resolutions)
+	i.Source, _ = find(rest, sources)
+	i.Codec, _ = find(rest, codecs)
+	i.Edition, _ = find(rest, editions)
+	var m []string
+	if i.Audio, m = find(rest, audios); len(m) > 2 && m[1] != "" {
+		i.Audio += m[1] + "." + m[2]
+	}
+	i.Atmos = atmosRE.MatchString(rest)
+	i.HDR = hdrRE.MatchString(rest)
+	i.DV = dvRE.MatchString(rest)
+	i.Proper = properRE.MatchString(rest)
+	i.Repack = repackRE.MatchString(rest)
+	i.Internal = internalRE.MatchString(rest)
+
+	rest = siteRE.ReplaceAllString(extRE.ReplaceAllString(rest, ""), "")
+	if m := groupRE.FindStringSubmatch(rest); m != nil {
+		if _, err := strconv.Atoi(m[1]); err != nil && !notGroups[strings.ToLower(m[1])] {
+			i.Group = m[1]
+		}
+	}
+	if i.Group == "" {
+		i.Group = group
+	}
+	return i
+}
+
+func cleanTitle(s string) string {
+	return strings.TrimSpace(strings.NewReplacer(".", " ", "_", " ").Replace(s))
+}
+
+// The parse methods parse the numbers of a kind of release. If the name
+// matches they set the title and the numbers, and return what follows
+// them.
+
+func (i *Info) parseEpisode(body string) (string, bool) {
+	m := titleRE.FindStringSubmatchIndex(body)
+	if m == nil {
+		return "", false
+	}
+	i.Title = cleanTitle(body[m[2]:m[3]])
+	i.Season, _ = strconv.Atoi(body[m[4]:m[5]])
+	i.Episode, _ = strconv.Atoi(body[m[6]:m[7]])
+	return i.parseMore(body[m[1]:]), true
+}
+
+func (i *Info) parsePack(body string) (string, bool) {
+	m := packRE.FindStringSubmatchIndex(body)
+	// a part of a season, or an episode numbered in its season like
+	// "Show S2 - 05", is not a pack
+	if m == nil || partRE.MatchString(body[m[1]:]) {
+		return "", false
+	}
+	i.Title = cleanTitle(body[m[2]:m[3]])
+	i.Season, _ = strconv.Atoi(body[m[4]:m[5]])
+	i.Pack = true
+	for g := 6; g < len(m); g += 2 {
+		if m[g] < 0 {
+			continue
+		}
+		last, _ := strconv.Atoi(body[m[g]:m[g+1]])
+		for s := i.Season; s <= last && last > i.Season; s++ {
+			i.Seasons = append(i.Seasons, s)
+		}
+	}
+	return body[m[1]:], true
+}
+
+func (i *Info) parseDaily(body string) (string, bool) {
+	m := dailyRE.FindStringSubmatchIndex(body)
+	if m == nil {
+		return "", false
+	}
+	date, err := time.Parse("2006 01 02", body[m[4]:m[5]]+" "+body[m[6]:m[7]]+" "+body[m[8]:m[9]])
+	if err != nil {
+		return "", false
+	}
+	i.Title = cleanTitle(body[m[2]:m[3]])
+	i.AirDate = date
+	i.Season = date.Year()
+	i.Episode = int(date.Month())*100 + date.Day()
+	return body[m[1]:], true
+}
+
+func (i *Info) parseAbsolute(body string) (string, bool) {
+	m := absoluteRE.FindStringSubmatchIndex(body)
+	if m == nil {
+		return "", false
+	}
+	n, _ := strconv.Atoi(body[m[4]:m[5]])
+	// rather the year of a documentary or of the first airing, e.g.
+	// "Planet Earth - 2006"
+	if n >= 1900 && n < 2100 {
+		return "", false
+	}
+	title := body[m[2]:m[3]]
+	if s := animeSeasonRE.FindStringSubmatchIndex(title); s != nil {
+		// "Show S2 - 05" is the episode 5 of season 2
+		i.Season, _ = strconv.Atoi(title[s[2]:s[3]])
+		i.Episode = n
+		title = title[:s[0]]
+	} else {
+		i.Absolute = n
+		i.Season, i.Episode = 1, n
+	}
+	i.Title = cleanTitle(title)
+	return body[m[5]:], true
+}
+
+// tagsAhead returns true if s is empty or starts with a property of the
+// release, a tag in brackets or the group.
+func tagsAhead(s string) bool {
+	if strings.HasPrefix(s, "-") && groupRE.MatchString(extRE.ReplaceAllString(s, "")) {
+		return true
+	}
+	s = strings.TrimLeft(s, " ._")
+	if s == "" || s[0] == '[' || s[0] == '(' {
+		return true
+	}
+	w := s
+	if n := strings.IndexAny(s, " ._[(-"); n > 0 {
+		w = s[:n]
+	}
+	for _, tags := range [][]tag{resolutions, sources, codecs, audios, editions} {
+		if v, _ := find(w, tags); v != "" {
+			return true
+		}
+	}
+	for _, re := range []*regexp.Regexp{atmosRE, hdrRE, dvRE, properRE, repackRE, internalRE} {
+		if re.MatchString(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMore parses the other episodes of multi-episode releases, and
+// returns what follows them.
+func (i *Info) parseMore(rest string) string {
+	eps := []int{i.Episode}
+	for {
+		m := moreRE.FindStringSubmatchIndex(rest)
+		if m == nil {
+			break
+		}
+		n, _ := strconv.Atoi(rest[m[6]:m[7]])
+		last := eps[len(eps)-1]
+		// a range of more than a season is rather a part of the title
+		if n <= last || n-last > 50 {
+			break
+		}
+		// so is a bare number followed by words, like "S01E09 - 10
+		// Things"
+		if m[2] >= 0 && m[4] < 0 && !tagsAhead(rest[m[7]:]) {
+			break
+		}
+		if m[2] >= 0 {
+			for e := last + 1; e < n; e++ {
+				eps = append(eps, e)
+			}
+		}
+		eps = append(eps, n)
+		rest = rest[m[7]:]
+	}
+	if len(eps) > 1 {
+		i.Episodes = eps
+	}
+	return rest
+}
@@ -0,0 +1,152 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		want Info
+	}{
+		// eztv
+		{"Mr Robot S03E01 720p HDTV x264-KILLERS", Info{Title: "Mr Robot", Season: 3, Episode: 1, Resolution: "720p", Source: "HDTV", Codec: "x264", Group: "KILLERS"}},
+		{"Mr Robot S03E01 720p HDTV x264-KILLERS EZTV", Info{Title: "Mr Robot", Season: 3, Episode: 1, Resolution: "720p", Source: "HDTV", Codec: "x264", Group: "KILLERS"}},
+		{"The Flash 2014 S05E03 HDTV x264-SVA [eztv]", Info{Title: "The Flash 2014", Season: 5, Episode: 3, Source: "HDTV", Codec: "x264", Group: "SVA"}},
+		{"Show.Name.S10E02.1080p.WEB.h264-GRP", Info{Title: "Show Name", Season: 10, Episode: 2, Resolution: "1080p", Source: "WEB", Codec: "x264", Group: "GRP"}},
+		{"Show.Name.S10E02.1080p.WEB.h264-GRP[eztv.re].mkv", Info{Title: "Show Name", Season: 10, Episode: 2, Resolution: "1080p", Source: "WEB", Codec: "x264", Group: "GRP"}},
+		{"The 100 S01E02", Info{Title: "The 100", Season: 1, Episode: 2}},
+		{"Show - 1x02 HDTV", Info{Title: "Show", Season: 1, Episode: 2, Source: "HDTV"}},
+		{"Show Name Complete", Info{Title: "Show Name Complete", Season: -1, Episode: -1}},
+		{"Show.Name.S01E01.480p.x264-mSD", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "480p", Codec: "x264", Group: "mSD"}},
+		{"show.name.s02e05.hdtv.xvid-lol.avi", Info{Title: "show name", Season: 2, Episode: 5, Source: "HDTV", Codec: "XviD", Group: "lol"}},
+		{"Show Name S02E05 PDTV XviD-FQM", Info{Title: "Show Name", Season: 2, Episode: 5, Source: "SDTV", Codec: "XviD", Group: "FQM"}},
+		{"Show.Name.S04E10.DSR.x264-2HD", Info{Title: "Show Name", Season: 4, Episode: 10, Source: "SDTV", Codec: "x264", Group: "2HD"}},
+
+		// web
+		{"Show.Name.S01E02.1080p.WEB-DL.DDP5.1.H.264-NTb", Info{Title: "Show Name", Season: 1, Episode: 2, Resolution: "1080p", Source: "WEB-DL", Codec: "x264", Audio: "DDP5.1", Group: "NTb"}},
+		{"Show.Name.S01E02.1080p.AMZN.WEB-DL.DD+5.1.H.264-NTG", Info{Title: "Show Name", Season: 1, Episode: 2, Resolution: "1080p", Source: "WEB-DL", Codec: "x264", Audio: "DDP5.1", Group: "NTG"}},
+		{"Show.Name.S01E02.720p.WEBRip.x264-ION10", Info{Title: "Show Name", Season: 1, Episode: 2, Resolution: "720p", Source: "WEBRip", Codec: "x264", Group: "ION10"}},
+		{"Show Name S01E02 720p WEB Rip AAC2.0 x264-BTW", Info{Title: "Show Name", Season: 1, Episode: 2, Resolution: "720p", Source: "WEBRip", Codec: "x264", Audio: "AAC2.0", Group: "BTW"}},
+		{"Show.Name.S01E02.WEBDL.1080p", Info{Title: "Show Name", Season: 1, Episode: 2, Resolution: "1080p", Source: "WEB-DL"}},
+		{"Show Name S01E02 1080p NF WEB-DL DDP 5.1 x264-NTb", Info{Title: "Show Name", Season: 1, Episode: 2, Resolution: "1080p", Source: "WEB-DL", Codec: "x264", Audio: "DDP5.1", Group: "NTb"}},
+		{"Show.Name.S01E02.WEB-DL", Info{Title: "Show Name", Season: 1, Episode: 2, Source: "WEB-DL"}},
+		{"Show.Name.S03E07.1080p.WEB.H265-GGEZ", Info{Title: "Show Name", Season: 3, Episode: 7, Resolution: "1080p", Source: "WEB", Codec: "x265", Group: "GGEZ"}},
+		{"Show Name S03E07 1080p HEVC x265-MeGusta", Info{Title: "Show Name", Season: 3, Episode: 7, Resolution: "1080p", Codec: "x265", Group: "MeGusta"}},
+		{"Show.Name.S03E07.1080p.WEB.AV1.Opus.5.1-GRP", Info{Title: "Show Name", Season: 3, Episode: 7, Resolution: "1080p", Source: "WEB", Codec: "AV1", Audio: "Opus5.1", Group: "GRP"}},
+		{"Show.Name.S03E07.720p.WEB.VP9-GRP", Info{Title: "Show Name", Season: 3, Episode: 7, Resolution: "720p", Source: "WEB", Codec: "VP9", Group: "GRP"}},
+		{"Show.Name.S03E07.x264.AVC-GRP", Info{Title: "Show Name", Season: 3, Episode: 7, Codec: "x264", Group: "GRP"}},
+
+		// 4k, hdr and dolby vision
+		{"Show.Name.S02E01.2160p.WEB-DL.DDP5.1.Atmos.HDR.HEVC-GRP", Info{Title: "Show Name", Season: 2, Episode: 1, Resolution: "2160p", Source: "WEB-DL", Codec: "x265", Audio: "DDP5.1", Atmos: true, HDR: true, Group: "GRP"}},
+		{"Show.Name.S02E01.2160p.AMZN.WEB-DL.DDP5.1.HDR10+.HEVC-GRP", Info{Title: "Show Name", Season: 2, Episode: 1, Resolution: "2160p", Source: "WEB-DL", Codec: "x265", Audio: "DDP5.1", HDR: true, Group: "GRP"}},
+		{"Show.Name.S02E01.2160p.WEB-DL.DV.HDR10.H.265-GRP", Info{Title: "Show Name", Season: 2, Episode: 1, Resolution: "2160p", Source: "WEB-DL", Codec: "x265", HDR: true, DV: true, Group: "GRP"}},
+		{"Show Name S02E01 4K DoVi WEB x265-GRP", Info{Title: "Show Name", Season: 2, Episode: 1, Resolution: "2160p", Source: "WEB", Codec: "x265", DV: true, Group: "GRP"}},
+		{"Show Name S02E01 UHD Dolby Vision WEBRip-GRP", Info{Title: "Show Name", Season: 2, Episode: 1, Resolution: "2160p", Source: "WEBRip", DV: true, Group: "GRP"}},
+		{"Show.Name.S02E01.1080p.HDR10Plus.WEB.x265-GRP", Info{Title: "Show Name", Season: 2, Episode: 1, Resolution: "1080p", Source: "WEB", Codec: "x265", HDR: true, Group: "GRP"}},
+
+		// bluray and dvd
+		{"Show.Name.S01E01.1080p.BluRay.x264-ROVERS", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Source: "BluRay", Codec: "x264", Group: "ROVERS"}},
+		{"Show.Name.S01E01.1080p.Blu-ray.Remux.AVC.DTS-HD.MA.5.1-EPSiLON", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Source: "BluRay", Codec: "x264", Audio: "DTS-HD MA5.1", Group: "EPSiLON"}},
+		{"Show.Name.S01E01.720p.BDRip.x264.AC3-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "720p", Source: "BluRay", Codec: "x264", Audio: "DD", Group: "GRP"}},
+		{"Show.Name.S01E01.2160p.UHD.BluRay.TrueHD.7.1.Atmos.x265-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "2160p", Source: "BluRay", Codec: "x265", Audio: "TrueHD7.1", Atmos: true, Group: "GRP"}},
+		{"Show.Name.S01E01.1080p.BluRay.DTS.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Source: "BluRay", Codec: "x264", Audio: "DTS", Group: "GRP"}},
+		{"Show.Name.S01E01.1080p.BluRay.DTS-X.7.1.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Source: "BluRay", Codec: "x264", Audio: "DTS-X7.1", Group: "GRP"}},
+		{"Show.Name.S01E01.1080p.BluRay.FLAC.2.0.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Source: "BluRay", Codec: "x264", Audio: "FLAC2.0", Group: "GRP"}},
+		{"Show.Name.S01E01.DVDRip.XviD-SAiNTS", Info{Title: "Show Name", Season: 1, Episode: 1, Source: "DVD", Codec: "XviD", Group: "SAiNTS"}},
+		{"Show.Name.S01E01.576p.DVD.x264.MP3-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "576p", Source: "DVD", Codec: "x264", Audio: "MP3", Group: "GRP"}},
+		{"Show.Name.S01E01.1080i.HDTV.DD5.1.MPEG2-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080i", Source: "HDTV", Audio: "DD5.1", Group: "GRP"}},
+
+		// markers and editions
+		{"Show.Name.S05E10.PROPER.720p.HDTV.x264-KILLERS", Info{Title: "Show Name", Season: 5, Episode: 10, Resolution: "720p", Source: "HDTV", Codec: "x264", Proper: true, Group: "KILLERS"}},
+		{"Show.Name.S05E10.REPACK.1080p.WEB.h264-TBS", Info{Title: "Show Name", Season: 5, Episode: 10, Resolution: "1080p", Source: "WEB", Codec: "x264", Repack: true, Group: "TBS"}},
+		{"Show.Name.S05E10.REPACK2.720p.WEB.h264-TBS", Info{Title: "Show Name", Season: 5, Episode: 10, Resolution: "720p", Source: "WEB", Codec: "x264", Repack: true, Group: "TBS"}},
+		{"Show.Name.S05E10.RERIP.720p.WEB.h264-TBS", Info{Title: "Show Name", Season: 5, Episode: 10, Resolution: "720p", Source: "WEB", Codec: "x264", Repack: true, Group: "TBS"}},
+		{"Show.Name.S05E10.iNTERNAL.720p.WEB.x264-GRP", Info{Title: "Show Name", Season: 5, Episode: 10, Resolution: "720p", Source: "WEB", Codec: "x264", Internal: true, Group: "GRP"}},
+		{"Show.Name.S05E10.REAL.PROPER.iNTERNAL.720p.HDTV.x264-GRP", Info{Title: "Show Name", Season: 5, Episode: 10, Resolution: "720p", Source: "HDTV", Codec: "x264", Proper: true, Internal: true, Group: "GRP"}},
+		{"Show.Name.S01E01.Extended.1080p.BluRay.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Source: "BluRay", Codec: "x264", Edition: "Extended", Group: "GRP"}},
+		{"Show Name S01E01 Extended Cut 720p WEB x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "720p", Source: "WEB", Codec: "x264", Edition: "Extended", Group: "GRP"}},
+		{"Show.Name.S01E01.Directors.Cut.1080p.WEB.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Source: "WEB", Codec: "x264", Edition: "Director's Cut", Group: "GRP"}},
+		{"Show.Name.S01E01.UNCUT.720p.HDTV.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "720p", Source: "HDTV", Codec: "x264", Edition: "Uncut", Group: "GRP"}},
+		{"Show.Name.S01E01.Remastered.1080p.BluRay.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Source: "BluRay", Codec: "x264", Edition: "Remastered", Group: "GRP"}},
+
+		// words of the show title are not properties
+		{"Dark Web S01E01 720p HDTV x264-GRP", Info{Title: "Dark Web", Season: 1, Episode: 1, Resolution: "720p", Source: "HDTV", Codec: "x264", Group: "GRP"}},
+		{"The Proper Show S01E01 1080p WEB-DL", Info{Title: "The Proper Show", Season: 1, Episode: 1, Resolution: "1080p", Source: "WEB-DL"}},
+		{"Show.Name.S01E01.HDTV.DTS-HD", Info{Title: "Show Name", Season: 1, Episode: 1, Source: "HDTV", Audio: "DTS-HD"}},
+
+		// no group
+		{"Show Name S01E01 720p HDTV x264", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "720p", Source: "HDTV", Codec: "x264"}},
+		{"Show Name - S01E01 - Pilot", Info{Title: "Show Name", Season: 1, Episode: 1}},
+		{"Show.Name.S01E01.720p-2019", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "720p"}},
+
+		// multi-episode
+		{"Show.Name.S01E01E02.720p.HDTV.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Episodes: []int{1, 2}, Resolution: "720p", Source: "HDTV", Codec: "x264", Group: "GRP"}},
+		{"Show.Name.S01E01.E02.E03.720p.HDTV.x264-GRP", Info{Title: "Show Name", Season: 1, Episode: 1, Episodes: []int{1, 2, 3}, Resolution: "720p", Source: "HDTV", Codec: "x264", Group: "GRP"}},
+		{"Show Name S02E01-E03 1080p WEB x264-GRP", Info{Title: "Show Name", Season: 2, Episode: 1, Episodes: []int{1, 2, 3}, Resolution: "1080p", Source: "WEB", Codec: "x264", Group: "GRP"}},
+		{"Show Name S02E09-10 1080p WEB x264-GRP", Info{Title: "Show Name", Season: 2, Episode: 9, Episodes: []int{9, 10}, Resolution: "1080p", Source: "WEB", Codec: "x264", Group: "GRP"}},
+		{"Show Name 2x09-2x10 HDTV", Info{Title: "Show Name", Season: 2, Episode: 9, Episodes: []int{9, 10}, Source: "HDTV"}},
+		{"Show.Name.S01E01-720p.HDTV-2HD", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "720p", Source: "HDTV", Group: "2HD"}},
+		{"Show Name S01E05 - Pilot", Info{Title: "Show Name", Season: 1, Episode: 5}},
+		{"Show Name S01E09 - 10 Things", Info{Title: "Show Name", Season: 1, Episode: 9}},
+		{"Show.Name.S01E09-10.Things.720p", Info{Title: "Show Name", Season: 1, Episode: 9, Resolution: "720p"}},
+		{"Show.Name.S01E09-10", Info{Title: "Show Name", Season: 1, Episode: 9, Episodes: []int{9, 10}}},
+		{"Show.Name.S01E09-10-GRP", Info{Title: "Show Name", Season: 1, Episode: 9, Episodes: []int{9, 10}, Group: "GRP"}},
+		{"Show Name S01E09-10 [720p]", Info{Title: "Show Name", Season: 1, Episode: 9, Episodes: []int{9, 10}, Resolution: "720p"}},
+		{"Show Name S01E09-E10 Title Words", Info{Title: "Show Name", Season: 1, Episode: 9, Episodes: []int{9, 10}}},
+
+		// season packs
+		{"Show.Name.S03.1080p.WEB-DL.DDP5.1.H.264-NTb", Info{Title: "Show Name", Season: 3, Episode: -1, Pack: true, Resolution: "1080p", Source: "WEB-DL", Codec: "x264", Audio: "DDP5.1", Group: "NTb"}},
+		{"Show Name S03 COMPLETE 720p HDTV x264-GRP", Info{Title: "Show Name", Season: 3, Episode: -1, Pack: true, Resolution: "720p", Source: "HDTV", Codec: "x264", Group: "GRP"}},
+		{"Show Name Season 2 Complete", Info{Title: "Show Name", Season: 2, Episode: -1, Pack: true}},
+		{"Show.Name.Complete.Season.10.1080p.BluRay.x265-GRP", Info{Title: "Show Name", Season: 10, Episode: -1, Pack: true, Resolution: "1080p", Source: "BluRay", Codec: "x265", Group: "GRP"}},
+		{"Show.Name.S1.REPACK.720p", Info{Title: "Show Name", Season: 1, Episode: -1, Pack: true, Resolution: "720p", Repack: true}},
+		{"Show.Name.S01-S03.COMPLETE.1080p.WEB-DL-GRP", Info{Title: "Show Name", Season: 1, Episode: -1, Pack: true, Seasons: []int{1, 2, 3}, Resolution: "1080p", Source: "WEB-DL", Group: "GRP"}},
+		{"Show Name Season 1-2 720p", Info{Title: "Show Name", Season: 1, Episode: -1, Pack: true, Seasons: []int{1, 2}, Resolution: "720p"}},
+		{"Show Name S03 Part 1 1080p", Info{Title: "Show Name S03 Part 1 1080p", Season: -1, Episode: -1, Resolution: "1080p"}},
+		{"Show.Name.S02.Vol.2.720p", Info{Title: "Show.Name.S02.Vol.2.720p", Season: -1, Episode: -1, Resolution: "720p"}},
+		{"Show.Name.S01-720p.HDTV", Info{Title: "Show Name", Season: 1, Episode: -1, Pack: true, Resolution: "720p", Source: "HDTV"}},
+
+		// specials
+		{"Show.Name.S00E05.Behind.the.Scenes.720p.WEB.x264-GRP", Info{Title: "Show Name", Season: 0, Episode: 5, Resolution: "720p", Source: "WEB", Codec: "x264", Group: "GRP"}},
+
+		// daily
+		{"The.Daily.Show.2024.03.11.Guest.Name.720p.WEB.h264-GRP", Info{Title: "The Daily Show", Season: 2024, Episode: 311, AirDate: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), Resolution: "720p", Source: "WEB", Codec: "x264", Group: "GRP"}},
+		{"Late Night Show 2023-12-01 1080p HDTV x264-GRP", Info{Title: "Late Night Show", Season: 2023, Episode: 1201, AirDate: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), Resolution: "1080p", Source: "HDTV", Codec: "x264", Group: "GRP"}},
+		{"Show 2024 02 30 HDTV", Info{Title: "Show 2024 02 30 HDTV", Season: -1, Episode: -1, Source: "HDTV"}},
+
+		// absolute numbering
+		{"[SubsPlease] One Piece - 1071 (1080p) [A1B2C3D4].mkv", Info{Title: "One Piece", Season: 1, Episode: 1071, Absolute: 1071, Resolution: "1080p", Group: "SubsPlease"}},
+		{"[Erai-raws] Show Name - 05v2 [720p][Multiple Subtitle].mkv", Info{Title: "Show Name", Season: 1, Episode: 5, Absolute: 5, Resolution: "720p", Group: "Erai-raws"}},
+		{"Show Name - 12 [1080p]", Info{Title: "Show Name", Season: 1, Episode: 12, Absolute: 12, Resolution: "1080p"}},
+		{"Planet Earth - 2006 [1080p]", Info{Title: "Planet Earth - 2006 [1080p]", Season: -1, Episode: -1, Resolution: "1080p"}},
+		{"Doctor Who - 1963 - An Unearthly Child.mkv", Info{Title: "Doctor Who - 1963 - An Unearthly Child.mkv", Season: -1, Episode: -1}},
+		{"[SubGroup] Show Name S01E01 [1080p]", Info{Title: "Show Name", Season: 1, Episode: 1, Resolution: "1080p", Group: "SubGroup"}},
+		{"[SubsPlease] Spy x Family S2 - 05 (1080p)", Info{Title: "Spy x Family", Season: 2, Episode: 5, Resolution: "1080p", Group: "SubsPlease"}},
+		{"[Group] Show Name Season 3 - 12v2 [720p]", Info{Title: "Show Name", Season: 3, Episode: 12, Resolution: "720p", Group: "Group"}},
+	}
+	for _, test := range tests {
+		if got := Parse(test.name); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q)\n got  %+v\n want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestQuality(t *testing.T) {
+	tests := []struct {
+		name    string
+		quality string
+	}{
+		{"Show.Name.S02E01.2160p.WEB-DL.DV.HDR10.H.265-GRP", "2160p WEB-DL x265 HDR DV"},
+		{"Mr Robot S03E01 720p HDTV x264-KILLERS", "720p HDTV x264"},
+		{"Show Name S01E01 1080p", "1080p"},
+		{"Show Name S01E01", ""},
+	}
+	for _, test := range tests {
+		if q := Parse(test.name).Quality(); q != test.quality {
+			t.Errorf("Parse(%q).Quality() = %q, expected %q", test.name, q, test.quality)
+		}
+	}
+}
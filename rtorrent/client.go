@@ -0,0 +1,212 @@
+// Package rtorrent is a client for the rTorrent XML-RPC interface, as
+// exposed by ruTorrent or a web server on /RPC2.
+package rtorrent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	URL    string
+	client *http.Client
+	user   string
+	pwd    string
+}
+
+// Torrent is the status of a torrent, as returned by d.multicall2 for
+// the commands in torrentCommands.
+type Torrent struct {
+	Hash           string
+	Name           string
+	Directory      string
+	SizeBytes      int64
+	CompletedBytes int64
+	DownRate       int64
+	UpRate         int64
+	Peers          int64
+	Started        bool // d.state
+	Active         bool // d.is_active
+	Complete       bool
+	Hashing        bool
+	Message        string
+	Label          string // d.custom1, the ruTorrent label
+}
+
+var torrentCommands = []interface{}{
+	"d.hash=", "d.name=", "d.directory=", "d.size_bytes=",
+	"d.completed_bytes=", "d.down.rate=", "d.up.rate=",
+	"d.peers_connected=", "d.state=", "d.is_active=", "d.complete=",
+	"d.hashing=", "d.message=", "d.custom1=",
+}
+
+// AddOptions are the settings of a new torrent.
+type AddOptions struct {
+	Directory string
+	Label     string
+	Paused    bool
+}
+
+// DefaultHTTPClient is used when NewClient is given a nil *http.Client.
+var DefaultHTTPClient = &http.Client{Timeout: time.Minute}
+
+// NewClient returns a client for the XML-RPC endpoint at URL (e.g.
+// http://host/RPC2), using HTTP basic authentication if user is set.
+// Requests are sent with hc, or DefaultHTTPClient if hc is nil.
+func NewClient(ctx context.Context, hc *http.Client, URL, user, password string) (*Client, error) {
+	if hc == nil {
+		hc = DefaultHTTPClient
+	}
+	c := &Client{URL: URL, client: hc, user: user, pwd: password}
+	_, err := c.Call(ctx, "system.client_version")
+	return c, err
+}
+
+// Call runs the XML-RPC method and returns its decoded result.
+func (c *Client) Call(ctx context.Context, method string, params ...interface{}) (interface{}, error) {
+	body, err := encodeCall(method, params)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.pwd)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("got error %d (%s) while calling %s", resp.StatusCode, resp.Status, method)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	result, err := decodeResponse(data)
+	if f, ok := err.(*Fault); ok {
+		return nil, fmt.Errorf("%s: %v", method, f)
+	}
+	return result, err
+}
+
+// quote quotes a command argument for rTorrent.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// AddTorrent loads a magnet link or a torrent URL, setting its
+// directory and label, and starts it unless opts.Paused is true.
+func (c *Client) AddTorrent(ctx context.Context, uri string, opts AddOptions) error {
+	method := "load.start_verbose"
+	if opts.Paused {
+		method = "load.verbose"
+	}
+	params := []interface{}{"", uri}
+	if opts.Directory != "" {
+		params = append(params, "d.directory.set="+quote(opts.Directory))
+	}
+	if opts.Label != "" {
+		params = append(params, "d.custom1.set="+quote(opts.Label))
+	}
+	_, err := c.Call(ctx, method, params...)
+	return err
+}
+
+// Torrents returns the torrents with the given hashes, or all of them if
+// no hash is given.
+func (c *Client) Torrents(ctx context.Context, hashes ...string) ([]Torrent, error) {
+	result, err := c.Call(ctx, "d.multicall2", append([]interface{}{"", "main"}, torrentCommands...)...)
+	if err != nil {
+		return nil, err
+	}
+	rows, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("d.multicall2: unexpected result %T", result)
+	}
+	wanted := make(map[string]bool)
+	for _, h := range hashes {
+		wanted[strings.ToUpper(h)] = true
+	}
+
+	var torrents []Torrent
+	for _, row := range rows {
+		f, ok := row.([]interface{})
+		if !ok || len(f) != len(torrentCommands) {
+			return nil, fmt.Errorf("d.multicall2: unexpected row %v", row)
+		}
+		str := func(i int) string { s, _ := f[i].(string); return s }
+		num := func(i int) int64 { n, _ := f[i].(int64); return n }
+		t := Torrent{
+			Hash:           str(0),
+			Name:           str(1),
+			Directory:      str(2),
+			SizeBytes:      num(3),
+			CompletedBytes: num(4),
+			DownRate:       num(5),
+			UpRate:         num(6),
+			Peers:          num(7),
+			Started:        num(8) == 1,
+			Active:         num(9) == 1,
+			Complete:       num(10) == 1,
+			Hashing:        num(11) != 0,
+			Message:        str(12),
+			Label:          str(13),
+		}
+		if len(wanted) > 0 && !wanted[strings.ToUpper(t.Hash)] {
+			continue
+		}
+		torrents = append(torrents, t)
+	}
+	return torrents, nil
+}
+
+// hashCall runs a d.* command on each of the hashes.
+func (c *Client) hashCall(ctx context.Context, method string, hashes []string) error {
+	for _, h := range hashes {
+		if _, err := c.Call(ctx, method, strings.ToUpper(h)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Erase removes the torrents. rTorrent does not delete the data.
+func (c *Client) Erase(ctx context.Context, hashes ...string) error {
+	return c.hashCall(ctx, "d.erase", hashes)
+}
+
+// Start starts the torrents.
+func (c *Client) Start(ctx context.Context, hashes ...string) error {
+	return c.hashCall(ctx, "d.start", hashes)
+}
+
+// Stop stops the torrents.
+func (c *Client) Stop(ctx context.Context, hashes ...string) error {
+	return c.hashCall(ctx, "d.stop", hashes)
+}
+
+// Announce asks the trackers for more peers.
+func (c *Client) Announce(ctx context.Context, hashes ...string) error {
+	return c.hashCall(ctx, "d.tracker_announce", hashes)
+}
+
+// SetLabel sets the ruTorrent label of the torrents.
+func (c *Client) SetLabel(ctx context.Context, label string, hashes ...string) error {
+	for _, h := range hashes {
+		if _, err := c.Call(ctx, "d.custom1.set", strings.ToUpper(h), label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
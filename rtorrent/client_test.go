@@ -0,0 +1,199 @@
+package rtorrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// encodeResponse and decodeCall are the server side of the XML-RPC
+// subset, used by the stand-in.
+
+func encodeResponse(v interface{}) ([]byte, error) {
+	b := new(bytes.Buffer)
+	b.WriteString(xml.Header)
+	b.WriteString("<methodResponse><params><param>")
+	if err := encodeValue(b, v); err != nil {
+		return nil, err
+	}
+	b.WriteString("</param></params></methodResponse>")
+	return b.Bytes(), nil
+}
+
+func decodeCall(data []byte) (string, []interface{}, error) {
+	var call struct {
+		Method string     `xml:"methodName"`
+		Params []xmlValue `xml:"params>param>value"`
+	}
+	if err := xml.Unmarshal(data, &call); err != nil {
+		return "", nil, fmt.Errorf("xmlrpc: invalid call: %v", err)
+	}
+	var params []interface{}
+	for _, p := range call.Params {
+		d, err := p.decode()
+		if err != nil {
+			return "", nil, err
+		}
+		params = append(params, d)
+	}
+	return call.Method, params, nil
+}
+
+type call struct {
+	method string
+	params []interface{}
+}
+
+// fakeServer is an rTorrent XML-RPC stand-in. It records the calls and
+// answers d.multicall2 with the given rows.
+func fakeServer(t *testing.T, calls *[]call, rows []interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "rt" || p != "pwd" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		method, params, err := decodeCall(data)
+		if err != nil {
+			t.Errorf("invalid call: %v", err)
+			return
+		}
+		*calls = append(*calls, call{method, params})
+		var result interface{} = int64(0)
+		switch method {
+		case "system.client_version":
+			result = "0.9.8"
+		case "d.multicall2":
+			result = rows
+		case "d.erase", "d.start", "d.stop", "d.tracker_announce", "load.start_verbose", "load.verbose", "d.custom1.set":
+		default:
+			w.Write([]byte(xml.Header + `<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><i4>-506</i4></value></member>
+<member><name>faultString</name><value><string>Method '` + method + `' not defined</string></value></member>
+</struct></value></fault></methodResponse>`))
+			return
+		}
+		out, err := encodeResponse(result)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(out)
+	}))
+}
+
+func TestXMLRPCRoundTrip(t *testing.T) {
+	params := []interface{}{"a<b&c", int64(42), int64(1) << 40, true, 1.5, []byte("raw"),
+		[]interface{}{"x", int64(1)}, map[string]interface{}{"k": "v"}}
+	data, err := encodeCall("test.method", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, got, err := decodeCall(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != "test.method" {
+		t.Errorf("unexpected method %q", method)
+	}
+	if !reflect.DeepEqual(got, params) {
+		t.Errorf("expected %#v, got %#v", params, got)
+	}
+
+	// untyped values are strings
+	v, err := decodeResponse([]byte(`<methodResponse><params><param><value>plain</value></param></params></methodResponse>`))
+	if err != nil || v != "plain" {
+		t.Errorf("expected plain, got %v (%v)", v, err)
+	}
+}
+
+func TestAddTorrent(t *testing.T) {
+	ctx := context.Background()
+	var calls []call
+	srv := fakeServer(t, &calls, nil)
+	defer srv.Close()
+
+	if _, err := NewClient(ctx, nil, srv.URL, "rt", "wrong"); err == nil {
+		t.Errorf("expected error with a wrong password")
+	}
+	c, err := NewClient(ctx, nil, srv.URL, "rt", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls = nil
+	err = c.AddTorrent(ctx, "magnet:?xt=urn:btih:abcd", AddOptions{Directory: `/data/Show "1"`, Label: "tv/Show"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []interface{}{"", "magnet:?xt=urn:btih:abcd", `d.directory.set="/data/Show \"1\""`, `d.custom1.set="tv/Show"`}
+	if len(calls) != 1 || calls[0].method != "load.start_verbose" || !reflect.DeepEqual(calls[0].params, expect) {
+		t.Errorf("unexpected calls %v", calls)
+	}
+
+	calls = nil
+	if err := c.AddTorrent(ctx, "magnet:?xt=urn:btih:abcd", AddOptions{Paused: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0].method != "load.verbose" {
+		t.Errorf("expected load.verbose for a paused torrent, got %v", calls)
+	}
+}
+
+func TestTorrents(t *testing.T) {
+	ctx := context.Background()
+	row := func(hash string, done int64) []interface{} {
+		return []interface{}{hash, "Show.S01E01", "/data", int64(100), done, int64(10), int64(0),
+			int64(3), int64(1), int64(1), int64(0), int64(0), "", "tv/Show"}
+	}
+	var calls []call
+	srv := fakeServer(t, &calls, []interface{}{row("ABCD", 50), row("EF01", 100)})
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "rt", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := c.Torrents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 torrents, got %d", len(all))
+	}
+	torrents, err := c.Torrents(ctx, "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 {
+		t.Fatalf("expected 1 torrent, got %d", len(torrents))
+	}
+	tr := torrents[0]
+	if tr.Hash != "ABCD" || tr.CompletedBytes != 50 || !tr.Started || tr.Peers != 3 || tr.Label != "tv/Show" {
+		t.Errorf("unexpected torrent %+v", tr)
+	}
+}
+
+func TestFault(t *testing.T) {
+	ctx := context.Background()
+	var calls []call
+	srv := fakeServer(t, &calls, nil)
+	defer srv.Close()
+	c, err := NewClient(ctx, nil, srv.URL, "rt", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Call(ctx, "no.such.method"); err == nil || !bytes.Contains([]byte(err.Error()), []byte("not defined")) {
+		t.Errorf("expected fault, got %v", err)
+	}
+	if err := c.Erase(ctx, "abcd"); err != nil {
+		t.Fatal(err)
+	}
+	if last := calls[len(calls)-1]; last.method != "d.erase" || last.params[0] != "ABCD" {
+		t.Errorf("unexpected call %v", last)
+	}
+}
@@ -0,0 +1,189 @@
+package rtorrent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This file implements the small subset of XML-RPC spoken by rTorrent.
+// Values are decoded into string, int64, bool, float64, []byte,
+// []interface{} and map[string]interface{}.
+
+// Fault is an XML-RPC fault returned by the server.
+type Fault struct {
+	Code   int
+	String string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("%s (code %d)", f.String, f.Code)
+}
+
+func encodeCall(method string, params []interface{}) ([]byte, error) {
+	b := new(bytes.Buffer)
+	b.WriteString(xml.Header)
+	b.WriteString("<methodCall><methodName>")
+	xml.EscapeText(b, []byte(method))
+	b.WriteString("</methodName><params>")
+	for _, p := range params {
+		b.WriteString("<param>")
+		if err := encodeValue(b, p); err != nil {
+			return nil, err
+		}
+		b.WriteString("</param>")
+	}
+	b.WriteString("</params></methodCall>")
+	return b.Bytes(), nil
+}
+
+func encodeValue(b *bytes.Buffer, v interface{}) error {
+	b.WriteString("<value>")
+	switch v := v.(type) {
+	case string:
+		b.WriteString("<string>")
+		xml.EscapeText(b, []byte(v))
+		b.WriteString("</string>")
+	case int:
+		encodeInt(b, int64(v))
+	case int64:
+		encodeInt(b, v)
+	case bool:
+		if v {
+			b.WriteString("<boolean>1</boolean>")
+		} else {
+			b.WriteString("<boolean>0</boolean>")
+		}
+	case float64:
+		fmt.Fprintf(b, "<double>%s</double>", strconv.FormatFloat(v, 'f', -1, 64))
+	case []byte:
+		fmt.Fprintf(b, "<base64>%s</base64>", base64.StdEncoding.EncodeToString(v))
+	case []string:
+		b.WriteString("<array><data>")
+		for _, e := range v {
+			encodeValue(b, e)
+		}
+		b.WriteString("</data></array>")
+	case []interface{}:
+		b.WriteString("<array><data>")
+		for _, e := range v {
+			if err := encodeValue(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteString("</data></array>")
+	case map[string]interface{}:
+		b.WriteString("<struct>")
+		for name, e := range v {
+			b.WriteString("<member><name>")
+			xml.EscapeText(b, []byte(name))
+			b.WriteString("</name>")
+			if err := encodeValue(b, e); err != nil {
+				return err
+			}
+			b.WriteString("</member>")
+		}
+		b.WriteString("</struct>")
+	default:
+		return fmt.Errorf("xmlrpc: unsupported type %T", v)
+	}
+	b.WriteString("</value>")
+	return nil
+}
+
+func encodeInt(b *bytes.Buffer, i int64) {
+	if i >= math.MinInt32 && i <= math.MaxInt32 {
+		fmt.Fprintf(b, "<i4>%d</i4>", i)
+	} else {
+		fmt.Fprintf(b, "<i8>%d</i8>", i)
+	}
+}
+
+type xmlValue struct {
+	String *string `xml:"string"`
+	I4     *string `xml:"i4"`
+	I8     *string `xml:"i8"`
+	Int    *string `xml:"int"`
+	Bool   *string `xml:"boolean"`
+	Double *string `xml:"double"`
+	Base64 *string `xml:"base64"`
+	Array  *struct {
+		Values []xmlValue `xml:"data>value"`
+	} `xml:"array"`
+	Struct *struct {
+		Members []struct {
+			Name  string   `xml:"name"`
+			Value xmlValue `xml:"value"`
+		} `xml:"member"`
+	} `xml:"struct"`
+	// A value without type is a string
+	Text string `xml:",chardata"`
+}
+
+func (v xmlValue) decode() (interface{}, error) {
+	switch {
+	case v.String != nil:
+		return *v.String, nil
+	case v.I4 != nil:
+		return strconv.ParseInt(strings.TrimSpace(*v.I4), 10, 64)
+	case v.I8 != nil:
+		return strconv.ParseInt(strings.TrimSpace(*v.I8), 10, 64)
+	case v.Int != nil:
+		return strconv.ParseInt(strings.TrimSpace(*v.Int), 10, 64)
+	case v.Bool != nil:
+		return strings.TrimSpace(*v.Bool) == "1", nil
+	case v.Double != nil:
+		return strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+	case v.Base64 != nil:
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(*v.Base64))
+	case v.Array != nil:
+		values := []interface{}{}
+		for _, e := range v.Array.Values {
+			d, err := e.decode()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, d)
+		}
+		return values, nil
+	case v.Struct != nil:
+		members := make(map[string]interface{})
+		for _, m := range v.Struct.Members {
+			d, err := m.Value.decode()
+			if err != nil {
+				return nil, err
+			}
+			members[m.Name] = d
+		}
+		return members, nil
+	}
+	return v.Text, nil
+}
+
+func decodeResponse(data []byte) (interface{}, error) {
+	var resp struct {
+		Params []xmlValue `xml:"params>param>value"`
+		Fault  *xmlValue  `xml:"fault>value"`
+	}
+	if err := xml.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("xmlrpc: invalid response: %v", err)
+	}
+	if resp.Fault != nil {
+		f, err := resp.Fault.decode()
+		if err != nil {
+			return nil, err
+		}
+		m, _ := f.(map[string]interface{})
+		code, _ := m["faultCode"].(int64)
+		msg, _ := m["faultString"].(string)
+		return nil, &Fault{int(code), msg}
+	}
+	if len(resp.Params) == 0 {
+		return nil, nil
+	}
+	return resp.Params[0].decode()
+}
@@ -0,0 +1,278 @@
+// Package selection chooses the release to download among the ones of
+// an episode, scoring them by a policy of preferred qualities, codecs
+// and groups, and rejecting the unwanted ones.
+package selection
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arcimboldo/tv/eztv"
+	"github.com/arcimboldo/tv/release"
+)
+
+// The points given by each preference. A better quality always wins over
+// the other preferences, and a PROPER or REPACK wins over a better codec
+// and group of the same quality: there are at most 5 codecs, so codec and
+// group give at most 100 points.
+const (
+	qualityPoints = 1000
+	properPoints  = 200
+	groupPoints   = 50
+	codecPoints   = 10
+)
+
+// Policy is the configuration of the selection.
+type Policy struct {
+	// Qualities are regexps matched against the name and the torrent
+	// URL of the releases, best first
+	Qualities []string `yaml:"qualities,omitempty"`
+	// Required are regexps all the releases must match, Forbidden
+	// regexps none of them can match. Both are case insensitive.
+	Required  []string `yaml:"required,omitempty"`
+	Forbidden []string `yaml:"forbidden,omitempty"`
+	// PreferredGroups get a bonus, BlockedGroups are rejected
+	PreferredGroups []string `yaml:"preferred_groups,omitempty"`
+	BlockedGroups   []string `yaml:"blocked_groups,omitempty"`
+	// MinSize and MaxSize bound the size of single episodes, when
+	// known. Season packs are not checked.
+	MinSize Size `yaml:"min_size,omitempty"`
+	MaxSize Size `yaml:"max_size,omitempty"`
+	// MinSeeders rejects the releases with fewer seeders, when known
+	MinSeeders int `yaml:"min_seeders,omitempty"`
+	// Codecs are the preferred codecs, best first: x265, x264, AV1,
+	// VP9 or XviD. Aliases like HEVC or h264 are accepted.
+	Codecs []string `yaml:"codecs,omitempty"`
+}
+
+// Size is a size in bytes, given in the configuration like "700MB" or
+// "1.5 GB".
+type Size int64
+
+// UnmarshalYAML parses a size, with or without a unit.
+func (s *Size) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	n, err := ParseSize(str)
+	*s = Size(n)
+	return err
+}
+
+func (s Size) String() string {
+	return eztv.FormatSize(int64(s))
+}
+
+var sizeRE = regexp.MustCompile(`(?i)^\s*([0-9]+(?:\.[0-9]+)?)\s*((?:[kmgt]i?)?b?)\s*$`)
+
+// ParseSize parses sizes like eztv shows them, e.g. "490 MB" or
+// "1.20 GB". Units are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	m := sizeRE.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit := strings.ToLower(m[2])
+	if unit != "" {
+		n *= float64(int64(1) << (10 * strings.IndexByte("bkmgt", unit[0])))
+	}
+	return int64(n), nil
+}
+
+// Selector scores releases by a policy.
+type Selector struct {
+	p         Policy
+	codecs    []string // normalized, without duplicates
+	qualities []*regexp.Regexp
+	required  []*regexp.Regexp
+	forbidden []*regexp.Regexp
+}
+
+func compile(res []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, re := range res {
+		r, err := regexp.Compile("(?i)" + re)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// New returns a selector for the policy p.
+func New(p Policy) (*Selector, error) {
+	s := &Selector{p: p}
+	var err error
+	if s.qualities, err = compile(p.Qualities); err != nil {
+		return nil, fmt.Errorf("invalid quality: %v", err)
+	}
+	if s.required, err = compile(p.Required); err != nil {
+		return nil, fmt.Errorf("invalid required word: %v", err)
+	}
+	if s.forbidden, err = compile(p.Forbidden); err != nil {
+		return nil, fmt.Errorf("invalid forbidden word: %v", err)
+	}
+	for _, c := range p.Codecs {
+		codec := release.Codec(c)
+		if codec == "" {
+			return nil, fmt.Errorf("unknown codec %q, must be one of x265, x264, AV1, VP9 or XviD", c)
+		}
+		if !containsFold(s.codecs, codec) {
+			s.codecs = append(s.codecs, codec)
+		}
+	}
+	return s, nil
+}
+
+// Candidate is a release with its score.
+type Candidate struct {
+	Episode  eztv.Episode
+	Score    int
+	Rejected bool
+	// Reasons tell where the score comes from, or why the release
+	// was rejected
+	Reasons []string
+}
+
+// Explain returns a line telling why the candidate got its score.
+func (c Candidate) Explain() string {
+	reasons := strings.Join(c.Reasons, ", ")
+	if c.Rejected {
+		return fmt.Sprintf("rejected %s: %s", c.Episode.Title, reasons)
+	}
+	if reasons == "" {
+		reasons = "no preference matched"
+	}
+	return fmt.Sprintf("%+6d %s: %s", c.Score, c.Episode.Title, reasons)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// rank returns the first i in [0, n) for which match is true, or -1.
+func rank(n int, match func(int) bool) int {
+	for i := 0; i < n; i++ {
+		if match(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// size returns the size of the episode, 0 if unknown.
+func size(e eztv.Episode) int64 {
+	if e.SizeBytes > 0 {
+		return e.SizeBytes
+	}
+	n, _ := ParseSize(e.Size)
+	return n
+}
+
+// Score scores a release.
+func (s *Selector) Score(e eztv.Episode) Candidate {
+	c := Candidate{Episode: e}
+	reject := func(format string, args ...interface{}) {
+		c.Rejected = true
+		c.Reasons = append(c.Reasons, fmt.Sprintf(format, args...))
+	}
+	add := func(points int, format string, args ...interface{}) {
+		c.Score += points
+		c.Reasons = append(c.Reasons, fmt.Sprintf(format, args...)+fmt.Sprintf(" %+d", points))
+	}
+	r := release.Parse(e.Title)
+
+	if e.DownloadURL() == "" {
+		reject("no magnet or torrent link")
+	}
+	for i, re := range s.required {
+		if !re.MatchString(e.Title) {
+			reject("missing required %q", s.p.Required[i])
+		}
+	}
+	for i, re := range s.forbidden {
+		if re.MatchString(e.Title) {
+			reject("forbidden %q", s.p.Forbidden[i])
+		}
+	}
+	if r.Group != "" && containsFold(s.p.BlockedGroups, r.Group) {
+		reject("group %s blocked", r.Group)
+	}
+	if n := size(e); n > 0 && !e.Pack {
+		if s.p.MinSize > 0 && n < int64(s.p.MinSize) {
+			reject("size %s < %s", eztv.FormatSize(n), s.p.MinSize)
+		}
+		if s.p.MaxSize > 0 && n > int64(s.p.MaxSize) {
+			reject("size %s > %s", eztv.FormatSize(n), s.p.MaxSize)
+		}
+	}
+	if e.Seeds >= 0 && e.Seeds < s.p.MinSeeders {
+		reject("%d seeders < %d", e.Seeds, s.p.MinSeeders)
+	}
+	if c.Rejected {
+		c.Score = 0
+		return c
+	}
+
+	q := rank(len(s.qualities), func(i int) bool {
+		return s.qualities[i].MatchString(e.Title) || s.qualities[i].MatchString(e.TorrentURL)
+	})
+	if q >= 0 {
+		add((len(s.qualities)-q)*qualityPoints, "quality %s (#%d)", s.p.Qualities[q], q+1)
+	}
+	if r.Codec != "" {
+		if i := rank(len(s.codecs), func(i int) bool { return s.codecs[i] == r.Codec }); i >= 0 {
+			add((len(s.codecs)-i)*codecPoints, "codec %s (#%d)", r.Codec, i+1)
+		}
+	}
+	if r.Group != "" && containsFold(s.p.PreferredGroups, r.Group) {
+		add(groupPoints, "group %s", r.Group)
+	}
+	if r.Proper || r.Repack {
+		add(properPoints, "PROPER/REPACK")
+	}
+	return c
+}
+
+// Rank scores the releases and sorts them, best first and rejected
+// last. Releases with the same score are sorted by seeders, then kept in
+// their order.
+func (s *Selector) Rank(eps []eztv.Episode) []Candidate {
+	var cs []Candidate
+	for _, e := range eps {
+		cs = append(cs, s.Score(e))
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		if cs[i].Rejected != cs[j].Rejected {
+			return !cs[i].Rejected
+		}
+		if cs[i].Score != cs[j].Score {
+			return cs[i].Score > cs[j].Score
+		}
+		return cs[i].Episode.Seeds > cs[j].Episode.Seeds
+	})
+	return cs
+}
+
+// Best returns the best release, or false if all of them are rejected.
+func (s *Selector) Best(eps []eztv.Episode) (eztv.Episode, bool) {
+	cs := s.Rank(eps)
+	if len(cs) == 0 || cs[0].Rejected {
+		return eztv.Episode{}, false
+	}
+	return cs[0].Episode, true
+}
@@ -0,0 +1,153 @@
+package selection
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arcimboldo/tv/eztv"
+)
+
+func ep(title string, seeds int, size string) eztv.Episode {
+	return eztv.Episode{Title: title, MagnetURL: "magnet:?xt=urn:btih:" + title, Seeds: seeds, Size: size}
+}
+
+func TestBest(t *testing.T) {
+	p := Policy{
+		Qualities:       []string{"1080p", "720p", "HDTV"},
+		Forbidden:       []string{`\bcam\b`},
+		PreferredGroups: []string{"NTb"},
+		BlockedGroups:   []string{"BadGrp"},
+		MaxSize:         4 << 30,
+		MinSeeders:      2,
+		Codecs:          []string{"x265", "x264"},
+	}
+	tests := []struct {
+		name   string
+		eps    []eztv.Episode
+		expect string
+	}{
+		{"quality order", []eztv.Episode{
+			ep("Show S01E01 HDTV x264-A", 10, ""),
+			ep("Show S01E01 1080p WEB x264-B", 10, ""),
+			ep("Show S01E01 720p WEB x264-C", 10, ""),
+		}, "Show S01E01 1080p WEB x264-B"},
+		{"codec", []eztv.Episode{
+			ep("Show S01E01 1080p WEB x264-A", 10, ""),
+			ep("Show S01E01 1080p WEB x265-B", 10, ""),
+		}, "Show S01E01 1080p WEB x265-B"},
+		{"proper over codec and group", []eztv.Episode{
+			ep("Show S01E01 1080p WEB x265-NTb", 10, ""),
+			ep("Show S01E01 PROPER 1080p WEB x264-A", 10, ""),
+		}, "Show S01E01 PROPER 1080p WEB x264-A"},
+		{"quality over proper", []eztv.Episode{
+			ep("Show S01E01 REPACK 720p WEB x264-A", 10, ""),
+			ep("Show S01E01 1080p WEB x264-B", 10, ""),
+		}, "Show S01E01 1080p WEB x264-B"},
+		{"preferred group", []eztv.Episode{
+			ep("Show S01E01 1080p WEB x264-A", 10, ""),
+			ep("Show S01E01 1080p WEB x264-NTb", 10, ""),
+		}, "Show S01E01 1080p WEB x264-NTb"},
+		{"seeders break ties", []eztv.Episode{
+			ep("Show S01E01 1080p WEB x264-A", 10, ""),
+			ep("Show S01E01 1080p WEB x264-B", 50, ""),
+		}, "Show S01E01 1080p WEB x264-B"},
+		{"rejected", []eztv.Episode{
+			ep("Show S01E01 1080p WEB x264-BadGrp", 10, ""),
+			ep("Show S01E01 1080p CAM x264-A", 10, ""),
+			ep("Show S01E01 1080p WEB x265-B", 1, ""),
+			ep("Show S01E01 1080p BluRay x264-C", 10, "5.20 GB"),
+			ep("Show S01E01 HDTV x264-D", -1, "350 MB"),
+		}, "Show S01E01 HDTV x264-D"},
+		{"all rejected", []eztv.Episode{
+			ep("Show S01E01 1080p CAM x264-A", 10, ""),
+			{Title: "Show S01E01 1080p WEB x264-B", Seeds: 10},
+		}, ""},
+	}
+	s, err := New(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		best, ok := s.Best(test.eps)
+		if best.Title != test.expect || ok != (test.expect != "") {
+			t.Errorf("%s: expected %q, got %q (%v)", test.name, test.expect, best.Title, ok)
+			for _, c := range s.Rank(test.eps) {
+				t.Log(c.Explain())
+			}
+		}
+	}
+
+	if _, err := New(Policy{Qualities: []string{"("}}); err == nil {
+		t.Errorf("expected error for an invalid quality regexp")
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	// aliases of the same codec are one preference
+	s, err := New(Policy{Codecs: []string{"HEVC", "h.265", "avc", "AV1", "vp9", "DivX"}, PreferredGroups: []string{"NTb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"x265", "x264", "AV1", "VP9", "XviD"}; !reflect.DeepEqual(s.codecs, expect) {
+		t.Errorf("expected codecs %v, got %v", expect, s.codecs)
+	}
+	if c := s.Score(ep("Show S01E01 1080p WEB x265-A", 10, "")); c.Score != 5*codecPoints {
+		t.Errorf("expected x265 to match HEVC: %s", c.Explain())
+	}
+	// the best codec and a preferred group do not beat a PROPER
+	eps := []eztv.Episode{
+		ep("Show S01E01 1080p WEB x265-NTb", 10, ""),
+		ep("Show S01E01 PROPER 1080p WEB-A", 10, ""),
+	}
+	if best, _ := s.Best(eps); best.Title != eps[1].Title {
+		t.Errorf("expected %q, got %q", eps[1].Title, best.Title)
+	}
+
+	if _, err := New(Policy{Codecs: []string{"h266"}}); err == nil {
+		t.Errorf("expected error for an unknown codec")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	s, err := New(Policy{Qualities: []string{"1080p", "720p"}, Codecs: []string{"x265"}, MinSeeders: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		e      eztv.Episode
+		expect string
+	}{
+		{ep("Show S01E01 720p WEB x265-A", 10, ""), " +1010 Show S01E01 720p WEB x265-A: quality 720p (#2) +1000, codec x265 (#1) +10"},
+		{ep("Show S01E01 WEB x264-A", 10, ""), "    +0 Show S01E01 WEB x264-A: no preference matched"},
+		{ep("Show S01E01 1080p WEB x265-A", 1, ""), "rejected Show S01E01 1080p WEB x265-A: 1 seeders < 5"},
+	}
+	for _, test := range tests {
+		if got := s.Score(test.e).Explain(); got != test.expect {
+			t.Errorf("expected %q, got %q", test.expect, got)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect int64
+	}{
+		{"490 MB", 490 << 20},
+		{"1.5 GB", 3 << 29},
+		{"700MiB", 700 << 20},
+		{"2g", 2 << 30},
+		{"1024", 1024},
+		{"12 KB", 12 << 10},
+	}
+	for _, test := range tests {
+		if n, err := ParseSize(test.in); err != nil || n != test.expect {
+			t.Errorf("ParseSize(%q) = %d (%v), expected %d", test.in, n, err, test.expect)
+		}
+	}
+	for _, in := range []string{"", "big", "1.2.3 GB", "10 PB", "5 i"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q): expected error", in)
+		}
+	}
+}
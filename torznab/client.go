@@ -0,0 +1,335 @@
+// Package torznab is a client for the Torznab API of indexers like
+// Jackett and Prowlarr.
+package torznab
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arcimboldo/tv/magnet"
+)
+
+type Client struct {
+	URL    string
+	client *http.Client
+	apiKey string
+}
+
+// Error is an error returned by the indexer, e.g. for a wrong API key.
+type Error struct {
+	Code        int    `xml:"code,attr"`
+	Description string `xml:"description,attr"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("torznab: %s (code %d)", e.Description, e.Code)
+}
+
+// Search is a capability of the indexer, e.g. tv-search.
+type Search struct {
+	Available       string `xml:"available,attr"`
+	SupportedParams string `xml:"supportedParams,attr"`
+}
+
+// Supports returns true if the search is available and accepts param.
+func (s Search) Supports(param string) bool {
+	if s.Available != "yes" {
+		return false
+	}
+	for _, p := range strings.Split(s.SupportedParams, ",") {
+		if strings.TrimSpace(p) == param {
+			return true
+		}
+	}
+	return false
+}
+
+type Category struct {
+	ID     int        `xml:"id,attr"`
+	Name   string     `xml:"name,attr"`
+	Subcat []Category `xml:"subcat"`
+}
+
+// Caps are the capabilities of the indexer, as returned by t=caps.
+type Caps struct {
+	Server struct {
+		Title   string `xml:"title,attr"`
+		Version string `xml:"version,attr"`
+	} `xml:"server"`
+	Limits struct {
+		Max     int `xml:"max,attr"`
+		Default int `xml:"default,attr"`
+	} `xml:"limits"`
+	Search     Search     `xml:"searching>search"`
+	TVSearch   Search     `xml:"searching>tv-search"`
+	Categories []Category `xml:"categories>category"`
+}
+
+// Item is a release found by a search.
+type Item struct {
+	Title       string
+	GUID        string
+	Link        string
+	Comments    string
+	PubDate     time.Time
+	Size        int64
+	Categories  []int
+	Seeders     int
+	Peers       int
+	InfoHash    string
+	MagnetURL   string
+	ImdbID      string
+	TvdbID      string
+	Season      int
+	Episode     int
+	Description string
+}
+
+// TorrentURL returns the link to the .torrent file, if any.
+func (i Item) TorrentURL() string {
+	if strings.HasPrefix(i.Link, "magnet:") {
+		return ""
+	}
+	return i.Link
+}
+
+// Magnet returns the magnet link of the release, if any.
+func (i Item) Magnet() string {
+	if i.MagnetURL != "" {
+		return i.MagnetURL
+	}
+	if strings.HasPrefix(i.Link, "magnet:") {
+		return i.Link
+	}
+	return ""
+}
+
+// xmlItem is an item of the RSS feed returned by a search. Extra
+// values are in torznab:attr or newznab:attr elements.
+type xmlItem struct {
+	Title     string `xml:"title"`
+	GUID      string `xml:"guid"`
+	Link      string `xml:"link"`
+	Comments  string `xml:"comments"`
+	PubDate   string `xml:"pubDate"`
+	Size      int64  `xml:"size"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+	Attrs       []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+}
+
+func (x xmlItem) item() Item {
+	it := Item{
+		Title:       x.Title,
+		GUID:        x.GUID,
+		Link:        x.Link,
+		Comments:    x.Comments,
+		Size:        x.Size,
+		Seeders:     -1,
+		Peers:       -1,
+		Season:      -1,
+		Episode:     -1,
+		Description: x.Description,
+	}
+	if it.Link == "" {
+		it.Link = x.Enclosure.URL
+	}
+	if it.Size == 0 {
+		it.Size = x.Enclosure.Length
+	}
+	if t, err := time.Parse(time.RFC1123Z, x.PubDate); err == nil {
+		it.PubDate = t
+	} else if t, err := time.Parse(time.RFC1123, x.PubDate); err == nil {
+		it.PubDate = t
+	}
+	for _, c := range x.Categories {
+		if id, err := strconv.Atoi(c); err == nil {
+			it.Categories = append(it.Categories, id)
+		}
+	}
+	for _, a := range x.Attrs {
+		n, _ := strconv.ParseInt(a.Value, 10, 64)
+		switch a.Name {
+		case "seeders":
+			it.Seeders = int(n)
+		case "peers":
+			it.Peers = int(n)
+		case "size":
+			it.Size = n
+		case "infohash":
+			it.InfoHash = strings.ToLower(a.Value)
+		case "magneturl":
+			it.MagnetURL = a.Value
+		case "imdbid", "imdb":
+			it.ImdbID = a.Value
+		case "tvdbid":
+			it.TvdbID = a.Value
+		case "season":
+			it.Season = int(n)
+		case "episode":
+			it.Episode = int(n)
+		case "category":
+			it.Categories = append(it.Categories, int(n))
+		}
+	}
+	if it.InfoHash == "" {
+		it.InfoHash = magnet.Hash(it.MagnetURL)
+	}
+	return it
+}
+
+// DefaultHTTPClient is used when NewClient is given a nil *http.Client.
+var DefaultHTTPClient = &http.Client{Timeout: time.Minute}
+
+// NewClient returns a client for the Torznab endpoint at URL, e.g.
+// http://localhost:9117/api/v2.0/indexers/all/results/torznab. Requests
+// are sent with hc, or DefaultHTTPClient if hc is nil.
+func NewClient(hc *http.Client, URL, apiKey string) *Client {
+	if hc == nil {
+		hc = DefaultHTTPClient
+	}
+	return &Client{URL: strings.TrimRight(URL, "/"), client: hc, apiKey: apiKey}
+}
+
+// get calls the API function t with params and decodes the reply into
+// result. Error replies are returned as *Error.
+func (c *Client) get(ctx context.Context, t string, params url.Values, result interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("t", t)
+	if c.apiKey != "" {
+		params.Set("apikey", c.apiKey)
+	}
+	u := c.URL
+	if !strings.HasSuffix(u, "/api") {
+		u += "/api"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// errors may come with any status, they are checked first
+	d := xml.NewDecoder(resp.Body)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if resp.StatusCode != 200 {
+				return fmt.Errorf("got error %d (%s) while calling %s", resp.StatusCode, resp.Status, t)
+			}
+			return fmt.Errorf("invalid reply to %s: %v", t, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "error" {
+			e := new(Error)
+			if err := d.DecodeElement(e, &start); err != nil {
+				return err
+			}
+			return e
+		}
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("got error %d (%s) while calling %s", resp.StatusCode, resp.Status, t)
+		}
+		return d.DecodeElement(result, &start)
+	}
+}
+
+// Caps returns the capabilities of the indexer.
+func (c *Client) Caps(ctx context.Context) (Caps, error) {
+	var caps Caps
+	err := c.get(ctx, "caps", nil, &caps)
+	return caps, err
+}
+
+// TVQuery are the parameters of TVSearch. Zero values are not sent.
+type TVQuery struct {
+	Query      string
+	Season     int
+	Episode    int
+	ImdbID     string
+	TvdbID     string
+	Categories []int
+	Limit      int
+	Offset     int
+}
+
+func (q TVQuery) values() url.Values {
+	v := url.Values{}
+	if q.Query != "" {
+		v.Set("q", q.Query)
+	}
+	if q.Season > 0 {
+		v.Set("season", strconv.Itoa(q.Season))
+	}
+	if q.Episode > 0 {
+		v.Set("ep", strconv.Itoa(q.Episode))
+	}
+	if q.ImdbID != "" {
+		// the imdb id is sent without the "tt" prefix
+		v.Set("imdbid", strings.TrimPrefix(q.ImdbID, "tt"))
+	}
+	if q.TvdbID != "" {
+		v.Set("tvdbid", q.TvdbID)
+	}
+	if len(q.Categories) > 0 {
+		var cats []string
+		for _, c := range q.Categories {
+			cats = append(cats, strconv.Itoa(c))
+		}
+		v.Set("cat", strings.Join(cats, ","))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		v.Set("offset", strconv.Itoa(q.Offset))
+	}
+	return v
+}
+
+// TVSearch runs a t=tvsearch query.
+func (c *Client) TVSearch(ctx context.Context, q TVQuery) ([]Item, error) {
+	return c.search(ctx, "tvsearch", q.values())
+}
+
+// Search runs a free text t=search query, for indexers without
+// tv-search.
+func (c *Client) Search(ctx context.Context, query string, categories ...int) ([]Item, error) {
+	return c.search(ctx, "search", TVQuery{Query: query, Categories: categories}.values())
+}
+
+func (c *Client) search(ctx context.Context, t string, params url.Values) ([]Item, error) {
+	var rss struct {
+		Items []xmlItem `xml:"channel>item"`
+	}
+	if err := c.get(ctx, t, params, &rss); err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, x := range rss.Items {
+		items = append(items, x.item())
+	}
+	return items, nil
+}
@@ -0,0 +1,101 @@
+package torznab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+// fakeServer serves the fixtures in testdata, as Jackett would, and
+// records the query of the last request.
+func fakeServer(t *testing.T, last *url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/torznab/api" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		*last = q
+		fixture := "error.xml"
+		if q.Get("apikey") == "secret" {
+			switch q.Get("t") {
+			case "caps":
+				fixture = "caps.xml"
+			case "tvsearch", "search":
+				fixture = "tvsearch.xml"
+			}
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		http.ServeFile(w, r, filepath.Join("testdata", fixture))
+	}))
+}
+
+func TestCaps(t *testing.T) {
+	var last url.Values
+	srv := fakeServer(t, &last)
+	defer srv.Close()
+	ctx := context.Background()
+
+	_, err := NewClient(nil, srv.URL+"/torznab", "wrong").Caps(ctx)
+	if e, ok := err.(*Error); !ok || e.Code != 100 {
+		t.Errorf("expected error 100, got %v", err)
+	}
+
+	caps, err := NewClient(nil, srv.URL+"/torznab/", "secret").Caps(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Server.Title != "Jackett" || caps.Limits.Max != 100 {
+		t.Errorf("unexpected caps %+v", caps)
+	}
+	if !caps.TVSearch.Supports("imdbid") || !caps.TVSearch.Supports("ep") || caps.Search.Supports("season") {
+		t.Errorf("unexpected searching capabilities %+v %+v", caps.Search, caps.TVSearch)
+	}
+	if len(caps.Categories) != 1 || len(caps.Categories[0].Subcat) != 2 || caps.Categories[0].Subcat[1].ID != 5040 {
+		t.Errorf("unexpected categories %+v", caps.Categories)
+	}
+}
+
+func TestTVSearch(t *testing.T) {
+	var last url.Values
+	srv := fakeServer(t, &last)
+	defer srv.Close()
+	c := NewClient(nil, srv.URL+"/torznab", "secret")
+
+	items, err := c.TVSearch(context.Background(), TVQuery{Query: "Mr Robot", Season: 3, Episode: 1, ImdbID: "tt4158110", Categories: []int{5030, 5040}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := url.Values{
+		"t": {"tvsearch"}, "apikey": {"secret"}, "q": {"Mr Robot"}, "season": {"3"},
+		"ep": {"1"}, "imdbid": {"4158110"}, "cat": {"5030,5040"},
+	}
+	if last.Encode() != expect.Encode() {
+		t.Errorf("expected query %s, got %s", expect.Encode(), last.Encode())
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+
+	it := items[0]
+	if it.Size != 2147483648 || it.Seeders != 42 || it.Peers != 50 || it.ImdbID != "tt4158110" {
+		t.Errorf("unexpected item %+v", it)
+	}
+	if it.InfoHash != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" || it.Magnet() != "magnet:?xt=urn:btih:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA&dn=Mr.Robot.S03E01" {
+		t.Errorf("unexpected hash or magnet in %+v", it)
+	}
+	if it.TorrentURL() == "" || it.PubDate.Year() != 2017 || it.Season != -1 {
+		t.Errorf("unexpected item %+v", it)
+	}
+
+	it = items[1]
+	if it.Magnet() != "magnet:?xt=urn:btih:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb&dn=Mr+Robot" || it.TorrentURL() != "" {
+		t.Errorf("unexpected links in %+v", it)
+	}
+	if it.Season != 3 || it.Episode != 1 || it.Seeders != 7 || it.Categories[0] != 5030 {
+		t.Errorf("unexpected item %+v", it)
+	}
+}
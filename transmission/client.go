@@ -2,143 +2,420 @@ package transmission
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Transmission struct {
 	URL       string
+	client    *http.Client
+	mu        sync.Mutex
 	sessionId string
 	user      string
 	pwd       string
 }
 
+// Status is the activity state of a torrent as reported by torrent-get.
+type Status int
+
+const (
+	StatusStopped Status = iota
+	StatusCheckWait
+	StatusCheck
+	StatusDownloadWait
+	StatusDownload
+	StatusSeedWait
+	StatusSeed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusStopped:
+		return "stopped"
+	case StatusCheckWait:
+		return "check pending"
+	case StatusCheck:
+		return "checking"
+	case StatusDownloadWait:
+		return "download pending"
+	case StatusDownload:
+		return "downloading"
+	case StatusSeedWait:
+		return "seed pending"
+	case StatusSeed:
+		return "seeding"
+	}
+	return fmt.Sprintf("status(%d)", int(s))
+}
+
+// TrInfo describes a torrent. torrent-add only fills ID, Name and
+// HashString, the other fields are set by GetTorrents.
 type TrInfo struct {
-	ID         int    `json:"id"`
-	Name       string `json:"name"`
-	HashString string `json:"hashString"`
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	HashString   string     `json:"hashString"`
+	Status       Status     `json:"status"`
+	PercentDone  float64    `json:"percentDone"`
+	Eta          int        `json:"eta"`
+	RateDownload int        `json:"rateDownload"`
+	RateUpload   int        `json:"rateUpload"`
+	Error        int        `json:"error"`
+	ErrorString  string     `json:"errorString"`
+	DownloadDir  string     `json:"downloadDir"`
+	TotalSize    int64      `json:"totalSize"`
+	AddedDate    int64      `json:"addedDate"`
+	DoneDate     int64      `json:"doneDate"`
+	Files        []File     `json:"files"`
+	FileStats    []FileStat `json:"fileStats"`
+	Peers        []Peer     `json:"peers"`
+	Labels       []string   `json:"labels"`
+}
+
+// Done returns true when all the wanted data has been downloaded.
+func (t TrInfo) Done() bool {
+	return t.PercentDone >= 1
+}
+
+type File struct {
+	Name           string `json:"name"`
+	Length         int64  `json:"length"`
+	BytesCompleted int64  `json:"bytesCompleted"`
 }
 
-func NewClient(URL, user, password string) (*Transmission, error) {
-	t := &Transmission{URL: URL, user: user, pwd: password}
+type FileStat struct {
+	BytesCompleted int64 `json:"bytesCompleted"`
+	Wanted         bool  `json:"wanted"`
+	Priority       int   `json:"priority"`
+}
+
+type Peer struct {
+	Address      string  `json:"address"`
+	Port         int     `json:"port"`
+	ClientName   string  `json:"clientName"`
+	Progress     float64 `json:"progress"`
+	RateToClient int     `json:"rateToClient"`
+	RateToPeer   int     `json:"rateToPeer"`
+}
+
+// TorrentFields are the fields requested by GetTorrents.
+var TorrentFields = []string{
+	"id", "name", "hashString", "status", "percentDone", "eta",
+	"rateDownload", "rateUpload", "error", "errorString", "downloadDir",
+	"totalSize", "addedDate", "doneDate", "files", "fileStats", "peers",
+	"labels",
+}
 
-	req, err := http.NewRequest("GET", strings.Trim(t.URL, "/")+"/transmission/rpc", nil)
+// DefaultHTTPClient is used when NewClient is given a nil *http.Client.
+var DefaultHTTPClient = &http.Client{Timeout: time.Minute}
+
+// NewClient connects to Transmission at URL using hc, or
+// DefaultHTTPClient if hc is nil.
+func NewClient(ctx context.Context, hc *http.Client, URL, user, password string) (*Transmission, error) {
+	if hc == nil {
+		hc = DefaultHTTPClient
+	}
+	t := &Transmission{URL: URL, client: hc, user: user, pwd: password}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.Trim(t.URL, "/")+"/transmission/rpc", nil)
 	if err != nil {
 		return t, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.SetBasicAuth(t.user, t.pwd)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := t.client.Do(req)
 	if err != nil {
 		return t, err
 	}
 	defer resp.Body.Close()
 
 	// Get the proper transmission id
-	t.sessionId = resp.Header.Get("X-Transmission-Session-Id")
-	if t.sessionId == "" {
+	if !t.updateSession(resp) {
 		return t, fmt.Errorf("unable initialize Transmission client. Server replied %d (%v)", resp.StatusCode, resp.Status)
 	}
 	return t, nil
 }
 
-func (t *Transmission) makeRequest(data io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/transmission/rpc", t.URL), data)
+// updateSession stores the session id sent by the server, if any, and
+// reports whether one was found.
+func (t *Transmission) updateSession(resp *http.Response) bool {
+	id := resp.Header.Get("X-Transmission-Session-Id")
+	if id == "" {
+		return false
+	}
+	t.mu.Lock()
+	t.sessionId = id
+	t.mu.Unlock()
+	return true
+}
+
+func (t *Transmission) makeRequest(ctx context.Context, data io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/transmission/rpc", t.URL), data)
 	if err != nil {
 		return req, err
 	}
+	t.mu.Lock()
+	sessionId := t.sessionId
+	t.mu.Unlock()
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Transmission-Session-Id", t.sessionId)
+	req.Header.Set("X-Transmission-Session-Id", sessionId)
 	req.SetBasicAuth(t.user, t.pwd)
 	return req, nil
 }
 
-func (t *Transmission) AddTorrent(magnet string) (TrInfo, error) {
+// post sends the body to the RPC endpoint. When the server replies 409
+// Conflict the session id has expired (e.g. Transmission was restarted):
+// the new id is taken from the reply and the request is sent again.
+func (t *Transmission) post(ctx context.Context, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := t.makeRequest(ctx, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusConflict || attempt > 0 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if !t.updateSession(resp) {
+			return nil, fmt.Errorf("server replied %d (%s) without a new session id", resp.StatusCode, resp.Status)
+		}
+	}
+}
+
+// call runs the RPC method with the given arguments and decodes the
+// arguments of the reply into result, unless result is nil.
+func (t *Transmission) call(ctx context.Context, method string, args, result interface{}) error {
 	data := struct {
-		Method    string `json:"method"`
-		Arguments struct {
-			Filename string `json:"filename"`
-		} `json:"arguments"`
-	}{}
-	data.Method = "torrent-add"
-	data.Arguments.Filename = magnet
+		Method    string      `json:"method"`
+		Arguments interface{} `json:"arguments,omitempty"`
+	}{method, args}
 
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(data)
-	req, err := t.makeRequest(b)
+	b, err := json.Marshal(data)
 	if err != nil {
-		return TrInfo{}, err
+		return err
 	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := t.post(ctx, b)
 	if err != nil {
-		return TrInfo{}, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return TrInfo{}, fmt.Errorf("got error %d (%s) while adding torrent.", resp.StatusCode, resp.Status)
+		return fmt.Errorf("got error %d (%s) while calling %s.", resp.StatusCode, resp.Status, method)
 	}
 
 	jresp := struct {
-		Arguments struct {
-			Info      TrInfo `json:"torrent-added"`
-			Duplicate TrInfo `json:"torrent-duplicate"`
-		} `json:"arguments"`
-		Result string `json:"result"`
+		Arguments json.RawMessage `json:"arguments"`
+		Result    string          `json:"result"`
 	}{}
-
-	json.NewDecoder(resp.Body).Decode(&jresp)
+	if err := json.NewDecoder(resp.Body).Decode(&jresp); err != nil {
+		return fmt.Errorf("invalid reply to %s: %v", method, err)
+	}
 	if jresp.Result != "success" {
-		return TrInfo{}, fmt.Errorf(jresp.Result)
+		return errors.New(jresp.Result)
 	}
-	if jresp.Arguments.Duplicate.HashString != "" {
-		return jresp.Arguments.Duplicate, fmt.Errorf("duplicated torrent with id %d", jresp.Arguments.Duplicate.ID)
+	if result == nil || len(jresp.Arguments) == 0 {
+		return nil
 	}
+	return json.Unmarshal(jresp.Arguments, result)
+}
 
-	return jresp.Arguments.Info, nil
+// checkIds ensures every id is either a numeric id or a hash string.
+func checkIds(ids []interface{}) error {
+	for _, id := range ids {
+		switch id.(type) {
+		case int, string:
+		default:
+			return fmt.Errorf("invalid torrent id %v: must be int or hash string", id)
+		}
+	}
+	return nil
+}
+
+// GetTorrents returns the status of the torrents with the given ids.
+// Each id is either a numeric torrent id or a hash string. If no id is
+// given all the torrents are returned.
+func (t *Transmission) GetTorrents(ctx context.Context, ids ...interface{}) ([]TrInfo, error) {
+	if err := checkIds(ids); err != nil {
+		return nil, err
+	}
+	args := struct {
+		Fields []string      `json:"fields"`
+		Ids    []interface{} `json:"ids,omitempty"`
+	}{TorrentFields, ids}
 
+	var reply struct {
+		Torrents []TrInfo `json:"torrents"`
+	}
+	err := t.call(ctx, "torrent-get", args, &reply)
+	return reply.Torrents, err
 }
 
-func (t *Transmission) AddTorrentTo(magnet, path string) (TrInfo, error) {
-	tinfo, err := t.AddTorrent(magnet)
+// GetTorrent returns the status of a single torrent, by id or hash string.
+func (t *Transmission) GetTorrent(ctx context.Context, id interface{}) (TrInfo, error) {
+	torrents, err := t.GetTorrents(ctx, id)
 	if err != nil {
-		return tinfo, err
+		return TrInfo{}, err
 	}
-	err = os.MkdirAll(path, 0755)
-	if err != nil {
-		return tinfo, err
+	if len(torrents) == 0 {
+		return TrInfo{}, fmt.Errorf("no such torrent %v", id)
 	}
+	return torrents[0], nil
+}
 
-	data := struct {
-		Method    string `json:"method"`
-		Arguments struct {
-			Location string `json:"location"`
-			Ids      []int  `json:"ids"`
-		} `json:"arguments"`
-	}{}
-	data.Method = "torrent-set-location"
-	data.Arguments.Location = path
-	data.Arguments.Ids = []int{tinfo.ID}
+// AddOptions are the arguments of torrent-add. Exactly one of Filename
+// (a magnet or torrent URL) and Metainfo (the content of a .torrent file)
+// must be set. Zero values and nil pointers are omitted, so the daemon
+// defaults apply; Paused and BandwidthPriority are pointers so that false
+// and the normal priority 0 can be given.
+type AddOptions struct {
+	Filename          string   `json:"filename,omitempty"`
+	Metainfo          []byte   `json:"metainfo,omitempty"`
+	Cookies           string   `json:"cookies,omitempty"`
+	DownloadDir       string   `json:"download-dir,omitempty"`
+	Paused            *bool    `json:"paused,omitempty"`
+	PeerLimit         int      `json:"peer-limit,omitempty"`
+	BandwidthPriority *int     `json:"bandwidthPriority,omitempty"`
+	FilesWanted       []int    `json:"files-wanted,omitempty"`
+	FilesUnwanted     []int    `json:"files-unwanted,omitempty"`
+	Labels            []string `json:"labels,omitempty"`
+}
 
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(data)
-	req, err := t.makeRequest(b)
-	if err != nil {
-		return tinfo, err
+// AddTorrentWith adds a torrent with all the given options in a single
+// call, so that it starts directly in its final location.
+func (t *Transmission) AddTorrentWith(ctx context.Context, opts AddOptions) (TrInfo, error) {
+	if (opts.Filename == "") == (len(opts.Metainfo) == 0) {
+		return TrInfo{}, fmt.Errorf("exactly one of filename and metainfo must be given")
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return tinfo, err
+	var reply struct {
+		Info      TrInfo `json:"torrent-added"`
+		Duplicate TrInfo `json:"torrent-duplicate"`
 	}
-	defer resp.Body.Close()
-	return tinfo, err
+	if err := t.call(ctx, "torrent-add", opts, &reply); err != nil {
+		return TrInfo{}, err
+	}
+	if reply.Duplicate.HashString != "" {
+		return reply.Duplicate, fmt.Errorf("duplicated torrent with id %d", reply.Duplicate.ID)
+	}
+
+	return reply.Info, nil
+}
+
+func (t *Transmission) AddTorrent(ctx context.Context, magnet string) (TrInfo, error) {
+	return t.AddTorrentWith(ctx, AddOptions{Filename: magnet})
+}
+
+// AddTorrentTo adds a torrent downloading it in path. The path is the
+// one seen by the Transmission daemon, which creates it if needed.
+func (t *Transmission) AddTorrentTo(ctx context.Context, magnet, path string) (TrInfo, error) {
+	return t.AddTorrentWith(ctx, AddOptions{Filename: magnet, DownloadDir: path})
+}
+
+// action runs one of the torrent action methods on the given ids. Unlike
+// torrent-get an empty list is refused, since Transmission would apply
+// the action to every torrent.
+func (t *Transmission) action(ctx context.Context, method string, ids []interface{}) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("%s: no torrent ids given", method)
+	}
+	if err := checkIds(ids); err != nil {
+		return err
+	}
+	args := struct {
+		Ids []interface{} `json:"ids"`
+	}{ids}
+	return t.call(ctx, method, args, nil)
+}
+
+// StartTorrents starts the given torrents, by id or hash string.
+func (t *Transmission) StartTorrents(ctx context.Context, ids ...interface{}) error {
+	return t.action(ctx, "torrent-start", ids)
+}
+
+// StartTorrentsNow starts the given torrents bypassing the download queue.
+func (t *Transmission) StartTorrentsNow(ctx context.Context, ids ...interface{}) error {
+	return t.action(ctx, "torrent-start-now", ids)
+}
+
+// StopTorrents stops the given torrents.
+func (t *Transmission) StopTorrents(ctx context.Context, ids ...interface{}) error {
+	return t.action(ctx, "torrent-stop", ids)
+}
+
+// VerifyTorrents checks the local data of the given torrents.
+func (t *Transmission) VerifyTorrents(ctx context.Context, ids ...interface{}) error {
+	return t.action(ctx, "torrent-verify", ids)
+}
+
+// ReannounceTorrents asks the trackers for more peers now.
+func (t *Transmission) ReannounceTorrents(ctx context.Context, ids ...interface{}) error {
+	return t.action(ctx, "torrent-reannounce", ids)
+}
+
+// RemoveTorrents removes the given torrents, and their downloaded data
+// if deleteLocalData is true.
+func (t *Transmission) RemoveTorrents(ctx context.Context, deleteLocalData bool, ids ...interface{}) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("torrent-remove: no torrent ids given")
+	}
+	if err := checkIds(ids); err != nil {
+		return err
+	}
+	args := struct {
+		Ids             []interface{} `json:"ids"`
+		DeleteLocalData bool          `json:"delete-local-data"`
+	}{ids, deleteLocalData}
+	return t.call(ctx, "torrent-remove", args, nil)
+}
+
+// SetLocation changes the download directory of the given torrents. If
+// move is true the downloaded data is moved to the new location,
+// otherwise Transmission looks for the data there.
+func (t *Transmission) SetLocation(ctx context.Context, location string, move bool, ids ...interface{}) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("torrent-set-location: no torrent ids given")
+	}
+	if err := checkIds(ids); err != nil {
+		return err
+	}
+	args := struct {
+		Ids      []interface{} `json:"ids"`
+		Location string        `json:"location"`
+		Move     bool          `json:"move"`
+	}{ids, location, move}
+	return t.call(ctx, "torrent-set-location", args, nil)
+}
+
+// SetFiles selects the files of the torrents to download. wanted and
+// unwanted are indexes in the Files of the torrents; the files in
+// neither list are left as they are.
+func (t *Transmission) SetFiles(ctx context.Context, wanted, unwanted []int, ids ...interface{}) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("torrent-set: no torrent ids given")
+	}
+	if err := checkIds(ids); err != nil {
+		return err
+	}
+	if len(wanted) == 0 && len(unwanted) == 0 {
+		return nil
+	}
+	// an empty list means all the files for Transmission, so empty
+	// lists are omitted
+	args := struct {
+		Ids           []interface{} `json:"ids"`
+		FilesWanted   []int         `json:"files-wanted,omitempty"`
+		FilesUnwanted []int         `json:"files-unwanted,omitempty"`
+	}{ids, wanted, unwanted}
+	return t.call(ctx, "torrent-set", args, nil)
 }
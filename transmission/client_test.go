@@ -0,0 +1,416 @@
+package transmission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type rpcRequest struct {
+	Method    string                 `json:"method"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// fake is a Transmission stand-in. It replies 409 Conflict with the
+// current session id to any request not carrying it, and answers each
+// RPC with the reply returned by handler.
+type fake struct {
+	*httptest.Server
+	mu        sync.Mutex
+	session   string
+	conflicts int
+}
+
+func (f *fake) conflictCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conflicts
+}
+
+// setSession changes the session id, as Transmission does on restart.
+func (f *fake) setSession(id string) {
+	f.mu.Lock()
+	f.session = id
+	f.mu.Unlock()
+}
+
+func fakeServer(t *testing.T, handler func(req rpcRequest) interface{}) *fake {
+	f := &fake{session: "sid"}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/transmission/rpc" {
+			http.NotFound(w, r)
+			return
+		}
+		f.mu.Lock()
+		session := f.session
+		if r.Header.Get("X-Transmission-Session-Id") != session {
+			f.conflicts++
+			f.mu.Unlock()
+			w.Header().Set("X-Transmission-Session-Id", session)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.mu.Unlock()
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result":    "success",
+			"arguments": handler(req),
+		})
+	}))
+	return f
+}
+
+func TestGetTorrents(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t, func(req rpcRequest) interface{} {
+		if req.Method != "torrent-get" {
+			t.Errorf("expected method torrent-get, got %q", req.Method)
+		}
+		ids, _ := req.Arguments["ids"].([]interface{})
+		if len(ids) != 2 || ids[0] != float64(1) || ids[1] != "abcd" {
+			t.Errorf("unexpected ids %v", req.Arguments["ids"])
+		}
+		return map[string]interface{}{
+			"torrents": []map[string]interface{}{{
+				"id":          1,
+				"name":        "Show.S01E01.720p.mkv",
+				"hashString":  "abcd",
+				"status":      4,
+				"percentDone": 0.5,
+				"eta":         120,
+				"errorString": "",
+				"downloadDir": "/downloads/Show/S01",
+				"files":       []map[string]interface{}{{"name": "Show.S01E01.720p.mkv", "length": 100, "bytesCompleted": 50}},
+				"peers":       []map[string]interface{}{{"address": "10.0.0.1", "port": 51413}},
+			}},
+		}
+	})
+	defer srv.Close()
+
+	tr, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrents, err := tr.GetTorrents(ctx, 1, "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 {
+		t.Fatalf("expected 1 torrent, got %d", len(torrents))
+	}
+	got := torrents[0]
+	if got.Status != StatusDownload || got.Status.String() != "downloading" {
+		t.Errorf("expected status downloading, got %v", got.Status)
+	}
+	if got.PercentDone != 0.5 || got.Eta != 120 || got.DownloadDir != "/downloads/Show/S01" {
+		t.Errorf("unexpected torrent %+v", got)
+	}
+	if len(got.Files) != 1 || got.Files[0].Length != 100 || len(got.Peers) != 1 {
+		t.Errorf("unexpected files or peers %+v", got)
+	}
+
+	if _, err := tr.GetTorrents(ctx, 1.5); err == nil {
+		t.Errorf("expected error for invalid id type")
+	}
+}
+
+func emptyReply(req rpcRequest) interface{} {
+	return map[string]interface{}{"torrents": []interface{}{}}
+}
+
+func TestSessionRenegotiation(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t, emptyReply)
+	defer srv.Close()
+
+	tr, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.sessionId != "sid" {
+		t.Fatalf("expected session id sid, got %q", tr.sessionId)
+	}
+
+	srv.setSession("sid2")
+	if _, err := tr.GetTorrents(ctx); err != nil {
+		t.Fatalf("expected call to succeed after session rotation, got %v", err)
+	}
+	if tr.sessionId != "sid2" {
+		t.Errorf("expected session id sid2, got %q", tr.sessionId)
+	}
+
+	// A second call must reuse the new id without another 409
+	conflicts := srv.conflictCount()
+	if _, err := tr.GetTorrents(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.conflictCount() - conflicts; n != 0 {
+		t.Errorf("expected no further conflicts, got %d", n)
+	}
+}
+
+func TestSessionRenegotiationConcurrent(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeServer(t, emptyReply)
+	defer srv.Close()
+
+	tr, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.setSession("sid2")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tr.GetTorrents(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSessionRenegotiationFails(t *testing.T) {
+	ctx := context.Background()
+	// A server that rotates the id on every request can never be satisfied
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.Header().Set("X-Transmission-Session-Id", string(rune('a'+n)))
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer srv.Close()
+
+	tr, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.GetTorrents(ctx); err == nil {
+		t.Errorf("expected error from a server always replying 409")
+	}
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	if _, err := tr.GetTorrents(ctx); err == nil {
+		t.Errorf("expected error from a 409 without session id")
+	}
+}
+
+func TestTorrentActions(t *testing.T) {
+	ctx := context.Background()
+	var got []rpcRequest
+	srv := fakeServer(t, func(req rpcRequest) interface{} {
+		got = append(got, req)
+		return nil
+	})
+	defer srv.Close()
+
+	tr, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		call   func() error
+	}{
+		{"torrent-start", func() error { return tr.StartTorrents(ctx, 1, "abcd") }},
+		{"torrent-start-now", func() error { return tr.StartTorrentsNow(ctx, 1, "abcd") }},
+		{"torrent-stop", func() error { return tr.StopTorrents(ctx, 1, "abcd") }},
+		{"torrent-verify", func() error { return tr.VerifyTorrents(ctx, 1, "abcd") }},
+		{"torrent-reannounce", func() error { return tr.ReannounceTorrents(ctx, 1, "abcd") }},
+		{"torrent-remove", func() error { return tr.RemoveTorrents(ctx, true, 1, "abcd") }},
+	}
+	for _, test := range tests {
+		got = nil
+		if err := test.call(); err != nil {
+			t.Errorf("%s: unexpected error %v", test.method, err)
+			continue
+		}
+		if len(got) != 1 || got[0].Method != test.method {
+			t.Errorf("expected a single %s call, got %+v", test.method, got)
+			continue
+		}
+		ids, _ := got[0].Arguments["ids"].([]interface{})
+		if len(ids) != 2 || ids[0] != float64(1) || ids[1] != "abcd" {
+			t.Errorf("%s: unexpected ids %v", test.method, got[0].Arguments["ids"])
+		}
+	}
+	if got[0].Arguments["delete-local-data"] != true {
+		t.Errorf("expected delete-local-data to be true, got %v", got[0].Arguments["delete-local-data"])
+	}
+
+	got = nil
+	if err := tr.StopTorrents(ctx); err == nil {
+		t.Errorf("expected error when no ids are given")
+	}
+	if err := tr.RemoveTorrents(ctx, false); err == nil {
+		t.Errorf("expected error when no ids are given")
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no calls without ids, got %+v", got)
+	}
+}
+
+func TestAddTorrentWith(t *testing.T) {
+	ctx := context.Background()
+	var got rpcRequest
+	srv := fakeServer(t, func(req rpcRequest) interface{} {
+		got = req
+		return map[string]interface{}{
+			"torrent-added": map[string]interface{}{"id": 3, "name": "Show.S01E02", "hashString": "ef01"},
+		}
+	})
+	defer srv.Close()
+
+	tr, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused, priority := true, 1
+	info, err := tr.AddTorrentWith(ctx, AddOptions{
+		Filename:          "magnet:?xt=urn:btih:ef01",
+		DownloadDir:       "/downloads/Show/S01",
+		Paused:            &paused,
+		BandwidthPriority: &priority,
+		FilesUnwanted:     []int{0, 2},
+		Labels:            []string{"tv/Show"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != 3 || info.HashString != "ef01" {
+		t.Errorf("unexpected torrent %+v", info)
+	}
+	if got.Method != "torrent-add" {
+		t.Errorf("expected torrent-add, got %q", got.Method)
+	}
+	args := got.Arguments
+	if args["download-dir"] != "/downloads/Show/S01" || args["paused"] != true || args["bandwidthPriority"] != float64(1) {
+		t.Errorf("unexpected arguments %v", args)
+	}
+	if labels, _ := args["labels"].([]interface{}); len(labels) != 1 || labels[0] != "tv/Show" {
+		t.Errorf("unexpected labels %v", args["labels"])
+	}
+	if _, ok := args["metainfo"]; ok {
+		t.Errorf("expected empty metainfo to be omitted, got %v", args["metainfo"])
+	}
+
+	// false and 0 are sent when given, omitted when not
+	paused, priority = false, 0
+	if _, err := tr.AddTorrentWith(ctx, AddOptions{Filename: "x", Paused: &paused, BandwidthPriority: &priority}); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := got.Arguments["paused"]; !ok || p != false {
+		t.Errorf("expected paused false, got %v", got.Arguments)
+	}
+	if p, ok := got.Arguments["bandwidthPriority"]; !ok || p != float64(0) {
+		t.Errorf("expected bandwidthPriority 0, got %v", got.Arguments)
+	}
+	if _, err := tr.AddTorrentWith(ctx, AddOptions{Filename: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Arguments["paused"]; ok {
+		t.Errorf("expected paused to be omitted, got %v", got.Arguments)
+	}
+
+	if _, err := tr.AddTorrentWith(ctx, AddOptions{}); err == nil {
+		t.Errorf("expected error without filename and metainfo")
+	}
+	if _, err := tr.AddTorrentWith(ctx, AddOptions{Filename: "x", Metainfo: []byte("y")}); err == nil {
+		t.Errorf("expected error with both filename and metainfo")
+	}
+}
+
+func TestSetFiles(t *testing.T) {
+	ctx := context.Background()
+	var got []rpcRequest
+	srv := fakeServer(t, func(req rpcRequest) interface{} {
+		got = append(got, req)
+		return nil
+	})
+	defer srv.Close()
+
+	tr, err := NewClient(ctx, nil, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.SetFiles(ctx, []int{1, 3}, []int{0, 2}, "abcd"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Method != "torrent-set" {
+		t.Fatalf("expected a single torrent-set call, got %+v", got)
+	}
+	args := got[0].Arguments
+	if wanted, _ := args["files-wanted"].([]interface{}); len(wanted) != 2 || wanted[0] != float64(1) || wanted[1] != float64(3) {
+		t.Errorf("unexpected files-wanted %v", args["files-wanted"])
+	}
+	if unwanted, _ := args["files-unwanted"].([]interface{}); len(unwanted) != 2 || unwanted[0] != float64(0) || unwanted[1] != float64(2) {
+		t.Errorf("unexpected files-unwanted %v", args["files-unwanted"])
+	}
+
+	// empty lists would select all the files
+	got = nil
+	if err := tr.SetFiles(ctx, []int{1}, nil, "abcd"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got[0].Arguments["files-unwanted"]; ok {
+		t.Errorf("expected empty files-unwanted to be omitted, got %v", got[0].Arguments)
+	}
+	got = nil
+	if err := tr.SetFiles(ctx, nil, nil, "abcd"); err != nil || len(got) != 0 {
+		t.Errorf("expected no call without files, got %+v (%v)", got, err)
+	}
+	if err := tr.SetFiles(ctx, []int{1}, nil); err == nil {
+		t.Errorf("expected error when no ids are given")
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	block := make(chan struct{})
+	srv := fakeServer(t, func(req rpcRequest) interface{} {
+		<-block
+		return nil
+	})
+	defer srv.Close()
+	defer close(block)
+
+	// The injected client is used for every request
+	var requests int
+	hc := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	tr, err := NewClient(ctx, hc, srv.URL, "admin", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := tr.GetTorrents(ctx); err == nil {
+		t.Errorf("expected error from a cancelled call")
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests through the injected client, got %d", requests)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}